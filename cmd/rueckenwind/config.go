@@ -3,23 +3,43 @@ package main
 import (
 	"log"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Default settings
 var (
-	port                int64  = 80
-	staticFilesDir      string = "./frontend/dist"
-	maxOverpassDistance int64  = 25
-	owmApiKey           string
-	debug               bool = false
-	domain              string
-	trackingUrl         string
-	trackingId          string
+	port                   int64         = 80
+	staticFilesDir         string        = "./frontend/dist"
+	maxOverpassDistance    int64         = 25
+	weatherProviders       []string      = []string{"openweathermap"}
+	weatherMaxFailures     int64         = 3
+	weatherCooldown        time.Duration = 5 * time.Minute
+	weatherCacheResolution float64       = 0.05
+	weatherForecastHours   int64         = 48
+	weatherAlertProvider   string
+	riderSpeed             float64 = 20
+	nowcastProvider        string
+	nowcastMinutes         int64 = 120
+	poiCategoriesFile      string
+	poiIndexFile           string
+	poiCacheFile           string
+	poiCacheTtl            time.Duration = 7 * 24 * time.Hour
+	poiCacheTileSize       float64       = 0.25
+	poiMinSeparation       float64       = 24
+	timezoneBoundariesFile string
+	demDir                 string
+	owmApiKey              string
+	debug                  bool = false
+	domain                 string
+	trackingUrl            string
+	trackingId             string
 )
 
-func init() {
+// Reads the settings of the server from the environment
+func loadConfig() {
 	var (
 		err    error
 		exists bool
@@ -54,9 +74,130 @@ func init() {
 		}
 	}
 
-	owmApiKey, exists = os.LookupEnv("OPEN_WEATHER_MAP_API_KEY")
+	poiCategoriesFile = os.Getenv("POI_CATEGORIES_FILE")
+	poiIndexFile = os.Getenv("POI_INDEX_FILE")
+	poiCacheFile = os.Getenv("POI_CACHE_FILE")
+
+	poiCacheTtlEnv, exists := os.LookupEnv("POI_CACHE_TTL")
+	if !exists {
+		log.Printf("POI_CACHE_TTL environment variable not set, using default value: %v", poiCacheTtl)
+	} else {
+		poiCacheTtl, err = time.ParseDuration(poiCacheTtlEnv)
+
+		if err != nil {
+			log.Fatal("Environment variable POI_CACHE_TTL must be a duration, e.g. 24h")
+		}
+	}
+
+	poiCacheTileSizeEnv, exists := os.LookupEnv("POI_CACHE_TILE_SIZE")
+	if !exists {
+		log.Printf("POI_CACHE_TILE_SIZE environment variable not set, using default value: %v", poiCacheTileSize)
+	} else {
+		poiCacheTileSize, err = strconv.ParseFloat(poiCacheTileSizeEnv, 64)
+
+		if err != nil || poiCacheTileSize <= 0 {
+			log.Fatal("Environment variable POI_CACHE_TILE_SIZE must be a positive number")
+		}
+	}
+
+	poiMinSeparationEnv, exists := os.LookupEnv("POI_MIN_SEPARATION")
+	if !exists {
+		log.Printf("POI_MIN_SEPARATION environment variable not set, using default value: %v", poiMinSeparation)
+	} else {
+		poiMinSeparation, err = strconv.ParseFloat(poiMinSeparationEnv, 64)
 
+		if err != nil || poiMinSeparation < 0 {
+			log.Fatal("Environment variable POI_MIN_SEPARATION must be a non-negative number")
+		}
+	}
+
+	timezoneBoundariesFile = os.Getenv("TIMEZONE_BOUNDARIES_FILE")
+	demDir = os.Getenv("DEM_DIR")
+
+	weatherProviderEnv, exists := os.LookupEnv("WEATHER_PROVIDER")
+	if !exists {
+		log.Printf("WEATHER_PROVIDER environment variable not set, using default value: %s", strings.Join(weatherProviders, ","))
+	} else {
+		weatherProviders = strings.Split(weatherProviderEnv, ",")
+		for i, provider := range weatherProviders {
+			weatherProviders[i] = strings.TrimSpace(provider)
+		}
+	}
+
+	weatherMaxFailuresEnv, exists := os.LookupEnv("WEATHER_PROVIDER_MAX_FAILURES")
 	if !exists {
+		log.Printf("WEATHER_PROVIDER_MAX_FAILURES environment variable not set, using default value: %d", weatherMaxFailures)
+	} else {
+		weatherMaxFailures, err = strconv.ParseInt(weatherMaxFailuresEnv, 10, 64)
+
+		if err != nil {
+			log.Fatal("Environment variable WEATHER_PROVIDER_MAX_FAILURES must be an integer")
+		}
+	}
+
+	weatherCooldownEnv, exists := os.LookupEnv("WEATHER_PROVIDER_COOLDOWN")
+	if !exists {
+		log.Printf("WEATHER_PROVIDER_COOLDOWN environment variable not set, using default value: %s", weatherCooldown)
+	} else {
+		weatherCooldown, err = time.ParseDuration(weatherCooldownEnv)
+
+		if err != nil {
+			log.Fatal("Environment variable WEATHER_PROVIDER_COOLDOWN must be a duration, e.g. 5m")
+		}
+	}
+
+	weatherCacheResolutionEnv, exists := os.LookupEnv("WEATHER_CACHE_RESOLUTION")
+	if !exists {
+		log.Printf("WEATHER_CACHE_RESOLUTION environment variable not set, using default value: %v", weatherCacheResolution)
+	} else {
+		weatherCacheResolution, err = strconv.ParseFloat(weatherCacheResolutionEnv, 64)
+
+		if err != nil || weatherCacheResolution < 0 {
+			log.Fatal("Environment variable WEATHER_CACHE_RESOLUTION must be a non-negative number")
+		}
+	}
+
+	weatherForecastHoursEnv, exists := os.LookupEnv("WEATHER_FORECAST_HOURS")
+	if !exists {
+		log.Printf("WEATHER_FORECAST_HOURS environment variable not set, using default value: %d", weatherForecastHours)
+	} else {
+		weatherForecastHours, err = strconv.ParseInt(weatherForecastHoursEnv, 10, 64)
+
+		// OpenWeatherMap returns at most 40 blocks of 3 hours
+		if err != nil || weatherForecastHours < 6 || weatherForecastHours > 120 {
+			log.Fatal("Environment variable WEATHER_FORECAST_HOURS must be an integer between 6 and 120")
+		}
+	}
+
+	weatherAlertProvider = os.Getenv("WEATHER_ALERT_PROVIDER")
+
+	nowcastProvider = os.Getenv("NOWCAST_PROVIDER")
+
+	nowcastMinutesEnv, exists := os.LookupEnv("NOWCAST_MINUTES")
+	if !exists {
+		log.Printf("NOWCAST_MINUTES environment variable not set, using default value: %d", nowcastMinutes)
+	} else {
+		nowcastMinutes, err = strconv.ParseInt(nowcastMinutesEnv, 10, 64)
+
+		if err != nil || nowcastMinutes < 60 || nowcastMinutes > 120 {
+			log.Fatal("Environment variable NOWCAST_MINUTES must be an integer between 60 and 120")
+		}
+	}
+
+	riderSpeedEnv, exists := os.LookupEnv("RIDER_SPEED")
+	if !exists {
+		log.Printf("RIDER_SPEED environment variable not set, using default value: %v", riderSpeed)
+	} else {
+		riderSpeed, err = strconv.ParseFloat(riderSpeedEnv, 64)
+
+		if err != nil || riderSpeed < 0 {
+			log.Fatal("Environment variable RIDER_SPEED must be a non-negative number")
+		}
+	}
+
+	owmApiKey, exists = os.LookupEnv("OPEN_WEATHER_MAP_API_KEY")
+
+	if !exists && slices.Contains(weatherProviders, "openweathermap") {
 		log.Fatal("Environment variable OPEN_WEATHER_MAP_API_KEY not found")
 	}
 
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/leomfn/rueckenwind/internal/services"
+)
+
+// Builds the offline POI index from an OSM extract, so that the server doesn't
+// have to read the whole extract at every start:
+//
+//	rueckenwind import -output pois.idx germany-latest.osm.pbf
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	output := flags.String("output", "pois.idx", "path of the POI index file to write")
+	categoriesFile := flags.String("categories", os.Getenv("POI_CATEGORIES_FILE"), "path of the POI categories file, defaults to the built-in categories")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: rueckenwind import [-output FILE] [-categories FILE] EXTRACT.osm.pbf")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	categories, err := services.LoadPoiCategories(*categoriesFile)
+	if err != nil {
+		log.Fatal("Could not load POI categories: ", err)
+	}
+
+	index, err := services.BuildPoiIndex(flags.Arg(0), categories)
+	if err != nil {
+		log.Fatal("Could not read OSM extract: ", err)
+	}
+
+	if err := index.Save(*output); err != nil {
+		log.Fatal("Could not write POI index: ", err)
+	}
+
+	log.Printf("Wrote %d POIs to %s", index.Len(), *output)
+}
@@ -2,15 +2,110 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"os"
+	"time"
 
 	"github.com/leomfn/rueckenwind/internal/handlers"
 	"github.com/leomfn/rueckenwind/internal/middleware"
 	"github.com/leomfn/rueckenwind/internal/server"
+	"github.com/leomfn/rueckenwind/internal/services"
+	"github.com/leomfn/rueckenwind/internal/timezone"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "timezones" {
+		runTimezones(os.Args[2:])
+		return
+	}
+
+	loadConfig()
+
 	rueckenwindServer := server.NewServer(port)
 
+	weatherProviderConfig := services.WeatherProviderConfig{
+		OwmApiKey:     owmApiKey,
+		ForecastHours: weatherForecastHours,
+		UserAgent:     fmt.Sprintf("rueckenwind (https://%s)", domain),
+	}
+
+	weatherService, err := services.NewFailoverWeatherService(weatherProviders, weatherProviderConfig, int(weatherMaxFailures), weatherCooldown)
+	if err != nil {
+		log.Fatal("Could not create weather service: ", err)
+	}
+
+	var alertService services.AlertService
+	if weatherAlertProvider != "" {
+		alertService, err = services.NewAlertService(weatherAlertProvider)
+		if err != nil {
+			log.Fatal("Could not create alert service: ", err)
+		}
+	}
+
+	timezones, err := timezone.NewResolver(timezoneBoundariesFile)
+	if err != nil {
+		log.Fatal("Could not load time zone boundaries: ", err)
+	}
+
+	var nowcastService services.NowcastService
+	if nowcastProvider != "" {
+		nowcastService, err = services.NewNowcastService(nowcastProvider, nowcastMinutes)
+		if err != nil {
+			log.Fatal("Could not create nowcast service: ", err)
+		}
+	}
+
+	var elevationService services.ElevationService
+	if demDir != "" {
+		elevationService = services.NewDemElevationService(demDir)
+	}
+
+	caches := map[string]services.Cache{}
+
+	if weatherCacheResolution > 0 {
+		weatherCache := services.NewWeatherCache(weatherService, weatherCacheResolution)
+		caches["weather"] = weatherCache
+		weatherService = weatherCache
+
+		if alertService != nil {
+			alertCache := services.NewAlertCache(alertService, weatherCacheResolution)
+			caches["alerts"] = alertCache
+			alertService = alertCache
+		}
+	}
+
+	// Nowcast providers cache the radar data themselves
+	if nowcastCache, ok := nowcastService.(services.Cache); ok {
+		caches["nowcast"] = nowcastCache
+	}
+
+	poiCategories, err := services.LoadPoiCategories(poiCategoriesFile)
+	if err != nil {
+		log.Fatal("Could not load POI categories: ", err)
+	}
+
+	poiService := services.NewOverpassPoiService(poiCategories, maxOverpassDistance, nil)
+
+	if poiIndexFile != "" {
+		poiIndex, err := services.LoadPoiIndex(poiIndexFile, poiCategories)
+		if err != nil {
+			log.Fatal("Could not load POI index: ", err)
+		}
+		log.Printf("Using offline POI index with %d POIs", poiIndex.Len())
+		poiService = services.NewOfflinePoiService(poiIndex, poiCategories, maxOverpassDistance)
+	} else if poiCacheTtl > 0 {
+		poiCache, err := services.NewPoiTileCache(poiCacheFile, poiCacheTileSize, poiCacheTtl)
+		if err != nil {
+			log.Fatal("Could not create POI cache: ", err)
+		}
+		caches["poi"] = poiCache
+		poiService = services.NewOverpassPoiService(poiCategories, maxOverpassDistance, poiCache)
+	}
+
 	sameSiteMiddleware := middleware.NewSameSiteMiddleware(domain, debug)
 
 	rootRouter := server.NewRouter("/")
@@ -19,8 +114,14 @@ func main() {
 	rootRouter.Handle("GET", "/health", handlers.NewHealthcheckHandler())
 
 	dataRouter := server.NewRouter("/data/")
-	dataRouter.Handle("POST", "/weather", handlers.NewWeatherHandler(owmApiKey), sameSiteMiddleware)
-	dataRouter.Handle("POST", "/poi", handlers.NewPoiHandler(maxOverpassDistance), sameSiteMiddleware)
+	dataRouter.Handle("POST", "/weather", handlers.NewWeatherHandler(weatherService, alertService, nowcastService, time.Duration(weatherForecastHours)*time.Hour, riderSpeed, timezones), sameSiteMiddleware)
+	dataRouter.Handle("POST", "/wind", handlers.NewWindHandler(weatherService, timezones, weatherCacheResolution), sameSiteMiddleware)
+	dataRouter.Handle("POST", "/recommendation", handlers.NewRecommendationHandler(weatherService, timezones), sameSiteMiddleware)
+	dataRouter.Handle("POST", "/poi", handlers.NewPoiHandler(poiService, poiCategories, timezones, elevationService, poiMinSeparation), sameSiteMiddleware)
+	dataRouter.Handle("POST", "/poi/route", handlers.NewRoutePoiHandler(poiService, poiCategories, timezones, elevationService), sameSiteMiddleware)
+	dataRouter.Handle("GET", "/poi/{osm_type}/{id}", handlers.NewPoiDetailsHandler(poiService), sameSiteMiddleware)
+	dataRouter.Handle("GET", "/categories", handlers.NewCategoriesHandler(poiCategories), sameSiteMiddleware)
+	dataRouter.Handle("GET", "/stats", handlers.NewCacheStatsHandler(caches), sameSiteMiddleware)
 
 	rueckenwindServer.AddRouter(rootRouter)
 	rueckenwindServer.AddRouter(dataRouter)
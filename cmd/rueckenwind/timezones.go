@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/leomfn/rueckenwind/internal/timezone"
+)
+
+// Builds the time zone grid from boundary polygons, e.g. combined.json of
+// timezone-boundary-builder or combined-with-oceans.reduce.bin of tzf, which
+// is much faster to load than the polygons, see package timezone:
+//
+//	rueckenwind timezones -output zones.grid combined-with-oceans.json
+func runTimezones(args []string) {
+	flags := flag.NewFlagSet("timezones", flag.ExitOnError)
+	output := flags.String("output", "zones.grid", "path of the time zone grid to write")
+	resolution := flags.Int("resolution", 10, "number of cells per degree")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: rueckenwind timezones [-output FILE] [-resolution N] BOUNDARIES")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *resolution < 1 || *resolution > 100 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	grid, err := timezone.BuildGrid(flags.Arg(0), *resolution)
+	if err != nil {
+		log.Fatal("Could not build time zone grid: ", err)
+	}
+
+	if err := grid.Save(*output); err != nil {
+		log.Fatal("Could not write time zone grid: ", err)
+	}
+
+	log.Printf("Wrote %d time zones to %s", grid.Len(), *output)
+}
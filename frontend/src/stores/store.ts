@@ -5,6 +5,14 @@ import campsiteUrl from '../../static/images/campsite.svg';
 import waterUrl from '../../static/images/water.svg';
 import coffeeUrl from '../../static/images/coffee.svg';
 import observationUrl from '../../static/images/observation.svg';
+import searchUrl from '../../static/images/search.svg';
+import bikeUrl from '../../static/images/bike.svg';
+import wrenchUrl from '../../static/images/wrench.svg';
+import toiletUrl from '../../static/images/toilet.svg';
+import shelterUrl from '../../static/images/shelter.svg';
+import supermarketUrl from '../../static/images/supermarket.svg';
+import bakeryUrl from '../../static/images/bakery.svg';
+import trainUrl from '../../static/images/train.svg';
 
 export const showAboutModal = writable<boolean>(false);
 export const showInfoModal = writable<boolean>(false);
@@ -39,3 +47,38 @@ export const poiSelectionChoices = writable<Record<string, {img: string, details
         img: observationUrl
     }
 })
+
+// Icons that can be referenced by the "icon" of a POI category
+const poiIcons: Record<string, string> = {
+    campsite: campsiteUrl,
+    water: waterUrl,
+    coffee: coffeeUrl,
+    observation: observationUrl,
+    bike: bikeUrl,
+    wrench: wrenchUrl,
+    toilet: toiletUrl,
+    shelter: shelterUrl,
+    supermarket: supermarketUrl,
+    bakery: bakeryUrl,
+    train: trainUrl,
+}
+
+// Replace the default choices with the categories configured on the server
+export const loadPoiCategories = () => {
+    fetch("/data/categories")
+        .then((res) => res.json())
+        .then((categories: { name: string, icon: string }[]) => {
+            const choices: Record<string, { img: string }> = {};
+
+            for (const category of categories) {
+                choices[category.name] = {
+                    img: poiIcons[category.icon] ?? searchUrl,
+                };
+            }
+
+            poiSelectionChoices.set(choices);
+        })
+        .catch(() => {
+            // Keep the default choices
+        });
+}
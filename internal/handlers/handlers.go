@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/leomfn/rueckenwind/internal/locale"
 	"github.com/leomfn/rueckenwind/internal/models"
 	"github.com/leomfn/rueckenwind/internal/services"
+	"github.com/leomfn/rueckenwind/internal/timezone"
 )
 
 // Healthcheck handler
@@ -31,6 +37,28 @@ func (h *healthcheckHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// Cache statistics, keyed by the name of the cache
+type cacheStatsHandler struct {
+	caches map[string]services.Cache
+}
+
+func NewCacheStatsHandler(caches map[string]services.Cache) *cacheStatsHandler {
+	return &cacheStatsHandler{
+		caches: caches,
+	}
+}
+
+func (h *cacheStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := map[string]services.CacheStats{}
+
+	for name, cache := range h.caches {
+		response[name] = cache.Stats()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // Index page
 type getIndexHandler struct {
 	directory string
@@ -81,45 +109,49 @@ func (h *staticFilesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // 	return err
 // }
 
-// General handler to facilitate location handling. It is not a http.Handler
-// itself, but can be embedded in other handlers that expect location data to be
-// sent via a form in a POST request.
-type locationHandler struct {
-	lon, lat float64
-}
-
-// Extracts the location coordinates from the request and stores them in the
-// handler. The error returned can be used as an error message to the client.
-func (h *locationHandler) extractLocation(r *http.Request) error {
-	// TODO: Add input validation
-	var coordinatesBody coordinates
-
-	err := json.NewDecoder(r.Body).Decode(&coordinatesBody)
-
-	if err != nil {
-		return errors.New("invalid request body")
-	}
-
-	h.lon = coordinatesBody.Lon
-	h.lat = coordinatesBody.Lat
-
-	return nil
+// Tells clients and caches in which language and units the response is.
+func setLocaleHeaders(w http.ResponseWriter, userLocale locale.Locale) {
+	w.Header().Set("Content-Language", userLocale.Lang)
+	w.Header().Set("X-Units", string(userLocale.Units))
+	w.Header().Add("Vary", "Accept-Language")
 }
 
 // Weather
 type weatherHandler struct {
-	locationHandler
 	service services.WeatherService
+	// Optional, official warnings are added to the forecast alerts
+	alerts services.AlertService
+	// Optional, rain of the next minutes from radar
+	nowcast services.NowcastService
+	// Maximum horizon of the forecast blocks
+	maxHorizon time.Duration
+	// Speed of the rider in km/h, for the wind chill
+	riderSpeed float64
+	// Time zone of the returned times
+	timezones *timezone.Resolver
+}
+
+type weatherData struct {
+	coordinates
+	// Hours of forecast blocks to return
+	Horizon float64 `json:"horizon"`
 }
 
+const defaultWeatherHorizon = 24 * time.Hour
+
 type WeatherBody struct {
 	coordinates
 	Category string `json:"category"`
 }
 
-func NewWeatherHandler(apiKey string) *weatherHandler {
+func NewWeatherHandler(service services.WeatherService, alerts services.AlertService, nowcast services.NowcastService, maxHorizon time.Duration, riderSpeed float64, timezones *timezone.Resolver) *weatherHandler {
 	return &weatherHandler{
-		service: services.NewOpenWeatherService(apiKey),
+		service:    service,
+		alerts:     alerts,
+		nowcast:    nowcast,
+		maxHorizon: maxHorizon,
+		riderSpeed: riderSpeed,
+		timezones:  timezones,
 	}
 }
 
@@ -129,22 +161,303 @@ type coordinates struct {
 }
 
 func (h *weatherHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := h.extractLocation(r)
+	var data weatherData
+
+	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
 		http.Error(w, "Could not read location", http.StatusBadRequest)
 		return
 	}
 
-	userLocation := models.Location{Lon: models.Coordinate(h.lon), Lat: models.Coordinate(h.lat)}
+	if data.Horizon < 0 {
+		http.Error(w, "horizon must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	horizon := min(defaultWeatherHorizon, h.maxHorizon)
+	if data.Horizon > 0 {
+		horizon = min(time.Duration(data.Horizon*float64(time.Hour)), h.maxHorizon)
+	}
+
+	weatherData, err := h.service.GetWeatherForecast(data.Lon, data.Lat)
+	if err != nil {
+		http.Error(w, "Could not fetch weather data", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(h.timezones.Lookup(data.Lon, data.Lat))
+
+	weatherData = weatherData.WithRiderSpeed(h.riderSpeed).WithHorizon(now, horizon)
+	weatherData.Alerts = models.NewForecastAlerts(weatherData.Forecast)
+
+	userLocation := models.Location{Lon: models.Coordinate(data.Lon), Lat: models.Coordinate(data.Lat)}
+	weatherData.Sun = models.NewSunTimes(userLocation, now)
+
+	// Official warnings are optional, the forecast is still useful without
+	if h.alerts != nil {
+		officialAlerts, err := h.alerts.GetAlerts(data.Lon, data.Lat)
+		if err != nil {
+			log.Println("Could not fetch official alerts:", err)
+		}
+
+		for _, alert := range officialAlerts {
+			if alert.Overlaps(now, now.Add(horizon)) {
+				weatherData.Alerts = append(weatherData.Alerts, alert)
+			}
+		}
+		models.SortAlerts(weatherData.Alerts)
+	}
+
+	if h.nowcast != nil {
+		weatherData.Nowcast, err = h.nowcast.GetNowcast(data.Lon, data.Lat)
+		if err != nil {
+			log.Println("Could not fetch nowcast:", err)
+		}
+	}
+
+	userLocale := locale.FromRequest(r)
+	setLocaleHeaders(w, userLocale)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(weatherData.In(now.Location()).Localize(userLocale))
+}
+
+// Wind relative to the direction of travel, either for a heading at the
+// location or for the segments of a route
+type windData struct {
+	Lon      float64  `json:"lon"`
+	Lat      float64  `json:"lat"`
+	Heading  *float64 `json:"heading"`
+	Gpx      string   `json:"gpx"`
+	Polyline string   `json:"polyline"`
+}
+
+type windBlockResponse struct {
+	Time        time.Time `json:"time"`
+	WindSpeed   float64   `json:"wind_speed"`
+	WindDegrees float64   `json:"wind_deg"`
+	models.WindComponents
+}
+
+type windSegmentResponse struct {
+	Heading float64 `json:"heading"`
+	// Distance of the start along the route and length of the segment in km
+	StartDistance float64             `json:"start_distance"`
+	Length        float64             `json:"length"`
+	Lon           float64             `json:"lon"`
+	Lat           float64             `json:"lat"`
+	Blocks        []windBlockResponse `json:"blocks"`
+}
+
+type windResponse struct {
+	Segments []windSegmentResponse `json:"segments"`
+	Source   string                `json:"source"`
+}
+
+const (
+	minWindSegmentLength = 10.0
+	// Each segment needs its own forecast, long routes get longer segments
+	maxWindSegments = 25
+	// Maximum number of concurrent forecast requests of a single route
+	maxWindLookups = 4
+	// Grid resolution (in degrees) of the forecasts, if the weather cache is
+	// disabled
+	defaultWindResolution = 0.05
+)
+
+// Grid cell of a segment midpoint. Segments in the same cell share a forecast.
+type windCell struct {
+	lon, lat int64
+}
+
+type windHandler struct {
+	service    services.WeatherService
+	timezones  *timezone.Resolver
+	resolution float64
+}
+
+// The resolution (in degrees) should match the one of the weather cache, so
+// that each forecast is a single cache entry.
+func NewWindHandler(service services.WeatherService, timezones *timezone.Resolver, resolution float64) *windHandler {
+	if resolution <= 0 {
+		resolution = defaultWindResolution
+	}
+
+	return &windHandler{
+		service:    service,
+		timezones:  timezones,
+		resolution: resolution,
+	}
+}
+
+func (h *windHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var data windData
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRouteBodySize)
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	var segments []models.RouteSegment
+
+	if data.Heading != nil {
+		location := models.Location{Lon: models.Coordinate(data.Lon), Lat: models.Coordinate(data.Lat)}
+		segments = []models.RouteSegment{{Start: location, End: location}}
+	} else {
+		route, err := parseRoute(data.Gpx, data.Polyline)
+		if err != nil {
+			http.Error(w, "heading or route required: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		segments = route.Segments(max(minWindSegmentLength, route.Length()/maxWindSegments))
+		if segments == nil {
+			http.Error(w, "route needs at least two points", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Midpoints are snapped to grid cells, each cell is requested only once
+	cells := make([]windCell, len(segments))
+	forecasts := map[windCell]*models.WeatherSummary{}
+	for i, segment := range segments {
+		midpoint := segment.Midpoint()
+		cells[i] = windCell{
+			lon: int64(math.Round(float64(midpoint.Lon) / h.resolution)),
+			lat: int64(math.Round(float64(midpoint.Lat) / h.resolution)),
+		}
+		forecasts[cells[i]] = &models.WeatherSummary{}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	lookups := make(chan struct{}, maxWindLookups)
+
+	for cell, summary := range forecasts {
+		wg.Go(func() {
+			lookups <- struct{}{}
+			defer func() { <-lookups }()
+
+			forecast, err := h.service.GetWeatherForecast(float64(cell.lon)*h.resolution, float64(cell.lat)*h.resolution)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+			*summary = forecast
+		})
+	}
+	wg.Wait()
 
-	weatherData, err := h.service.GetWeatherForecast(float64(userLocation.Lon), float64(userLocation.Lat))
+	if err := errors.Join(errs...); err != nil {
+		log.Println("Could not fetch weather data for wind analysis:", err)
+		http.Error(w, "Could not fetch weather data", http.StatusInternalServerError)
+		return
+	}
+
+	response := windResponse{Source: forecasts[cells[0]].Source}
+
+	for i, segment := range segments {
+		heading := segment.Heading()
+		if data.Heading != nil {
+			heading = *data.Heading
+		}
+
+		midpoint := segment.Midpoint()
+		location := h.timezones.Lookup(float64(midpoint.Lon), float64(midpoint.Lat))
+		segmentResponse := windSegmentResponse{
+			Heading:       heading,
+			StartDistance: segment.StartDistance,
+			Length:        segment.Length,
+			Lon:           float64(midpoint.Lon),
+			Lat:           float64(midpoint.Lat),
+		}
+
+		for _, block := range forecasts[cells[i]].Forecast {
+			segmentResponse.Blocks = append(segmentResponse.Blocks, windBlockResponse{
+				Time:           block.Time.In(location),
+				WindSpeed:      block.WindSpeed,
+				WindDegrees:    block.WindDegrees,
+				WindComponents: models.NewWindComponents(heading, block.WindSpeed, block.WindDegrees),
+			})
+		}
+
+		response.Segments = append(response.Segments, segmentResponse)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Outbound direction for a round trip starting now
+type recommendationData struct {
+	Lon float64 `json:"lon"`
+	Lat float64 `json:"lat"`
+	// Duration of the whole ride in hours
+	Duration float64 `json:"duration"`
+}
+
+type recommendationResponse struct {
+	models.Recommendation
+	Source string `json:"source"`
+}
+
+const maxRecommendationDuration = 24.0
+
+type recommendationHandler struct {
+	service   services.WeatherService
+	timezones *timezone.Resolver
+}
+
+func NewRecommendationHandler(service services.WeatherService, timezones *timezone.Resolver) *recommendationHandler {
+	return &recommendationHandler{
+		service:   service,
+		timezones: timezones,
+	}
+}
+
+func (h *recommendationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var data recommendationData
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if data.Duration <= 0 || data.Duration > maxRecommendationDuration {
+		http.Error(w, "duration must be between 0 and 24 hours", http.StatusBadRequest)
+		return
+	}
+
+	weatherData, err := h.service.GetWeatherForecast(data.Lon, data.Lat)
 	if err != nil {
 		http.Error(w, "Could not fetch weather data", http.StatusInternalServerError)
 		return
 	}
 
+	duration := time.Duration(data.Duration * float64(time.Hour))
+
+	now := time.Now().In(h.timezones.Lookup(data.Lon, data.Lat))
+
+	recommendation, err := models.NewRecommendation(weatherData.Forecast, now, duration)
+	if err != nil {
+		log.Println("Could not recommend a direction:", err)
+		http.Error(w, "Could not recommend a direction", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(weatherData)
+	json.NewEncoder(w).Encode(recommendationResponse{
+		Recommendation: recommendation,
+		Source:         weatherData.Source,
+	})
 }
 
 // POI sites
@@ -152,15 +465,40 @@ type poiData struct {
 	Lon      float64 `json:"lon"`
 	Lat      float64 `json:"lat"`
 	Category string  `json:"category"`
+	// Several categories at once, the response then contains the sites by
+	// category
+	Categories []string `json:"categories"`
+	// Hide POIs that are currently closed
+	OpenNow bool `json:"open_now"`
+	// Search radius in km, defaults to and is limited by the server maximum
+	Radius float64 `json:"radius"`
+	// Maximum number of sites, all by default. If there are more, the
+	// X-Next-Cursor header contains the cursor of the next page.
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+	// Hide sites that would overlap on the compass, lists turn this off to
+	// get all sites
+	Decluster *bool `json:"decluster"`
 }
 
 type poiHandler struct {
-	service services.PoiService
+	service    services.PoiService
+	categories services.PoiCategories
+	// Time zones used to evaluate opening hours
+	timezones *timezone.Resolver
+	// Optional, adds the elevation and ascent to the sites
+	elevation services.ElevationService
+	// Minimum distance (in pixels) between the sites on the compass
+	minSeparation float64
 }
 
-func NewPoiHandler(maxDistance int64) *poiHandler {
+func NewPoiHandler(service services.PoiService, categories services.PoiCategories, timezones *timezone.Resolver, elevation services.ElevationService, minSeparation float64) *poiHandler {
 	return &poiHandler{
-		service: services.NewOverpassPoiService(maxDistance),
+		service:       service,
+		categories:    categories,
+		timezones:     timezones,
+		elevation:     elevation,
+		minSeparation: minSeparation,
 	}
 }
 
@@ -174,28 +512,299 @@ func (h *poiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var poiResults models.OverpassSites
+	if len(data.Categories) > 0 && data.Category != "" {
+		http.Error(w, "either category or categories must be given", http.StatusBadRequest)
+		return
+	}
+
+	categories := data.Categories
+	if len(categories) == 0 {
+		categories = []string{data.Category}
+	}
+	for _, category := range categories {
+		if _, ok := h.categories.Get(category); !ok {
+			http.Error(w, "unknown category", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if data.Radius < 0 {
+		http.Error(w, "invalid radius", http.StatusBadRequest)
+		return
+	}
+	if data.Limit < 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if data.Cursor != "" {
+		// A single cursor can't continue several lists
+		if len(data.Categories) > 0 {
+			http.Error(w, "cursor requires a single category", http.StatusBadRequest)
+			return
+		}
+
+		offset, err = strconv.Atoi(data.Cursor)
+		if err != nil || offset < 0 {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userLocale := locale.FromRequest(r)
+
+	// Several categories are answered with a single query and the sites by
+	// category, limited to the first page each
+	if len(data.Categories) > 0 {
+		poiResults, err := h.service.GetPoisByCategory(data.Categories, data.Lon, data.Lat, data.Radius)
+
+		if err != nil {
+			log.Println("Cloud not fetch sites data:", err)
+			http.Error(w, "Error fetching sites", http.StatusInternalServerError)
+			return
+		}
+
+		for category, sites := range poiResults {
+			poiResults[category], _ = h.prepare(sites, data, 0, userLocale)
+		}
+		setLocaleHeaders(w, userLocale)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(poiResults)
+		return
+	}
+
+	poiResults, err := h.service.GetPois(data.Category, data.Lon, data.Lat, data.Radius)
+
+	if err != nil {
+		log.Println("Cloud not fetch sites data:", err)
+		http.Error(w, "Error fetching sites", http.StatusInternalServerError)
+		return
+	}
+
+	// The cursor is the offset of the next page in the sites ordered by
+	// distance
+	poiResults, next := h.prepare(poiResults, data, offset, userLocale)
+	if next > 0 {
+		w.Header().Set("X-Next-Cursor", strconv.Itoa(next))
+	}
+	setLocaleHeaders(w, userLocale)
 
-	switch data.Category {
-	case "camping":
-		poiResults, err = h.service.GetCampingPois(data.Lon, data.Lat)
-	case "water":
-		poiResults, err = h.service.GetDrinkingWaterPois(data.Lon, data.Lat)
-	case "cafe":
-		poiResults, err = h.service.GetCafePois(data.Lon, data.Lat)
-	case "observation":
-		poiResults, err = h.service.GetObservationPois(data.Lon, data.Lat)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poiResults)
+}
+
+// Filters the sites as requested and returns the page at the offset, with the
+// offset of the next page.
+func (h *poiHandler) prepare(sites models.OverpassSites, data poiData, offset int, userLocale locale.Locale) (models.OverpassSites, int) {
+	// Closed POIs are removed before declustering, so that they do not hide
+	// open ones nearby
+	sites.EvaluateOpeningHours(time.Now(), h.timezones.Lookup)
+	if data.OpenNow {
+		sites.RemoveClosed()
+	}
+	if data.Decluster == nil || *data.Decluster {
+		sites.Decluster(h.minSeparation)
+	}
+
+	sites, next := sites.Page(offset, data.Limit)
+
+	if h.elevation != nil {
+		userLocation := models.Location{Lon: models.Coordinate(data.Lon), Lat: models.Coordinate(data.Lat)}
+		sites.EvaluateElevation(&userLocation, h.elevation.Elevation)
+	}
+
+	sites.Localize(userLocale)
+
+	return sites, next
+}
+
+// Reads the route from a GPX file or, if empty, an encoded polyline.
+func parseRoute(gpx string, polyline string) (models.Route, error) {
+	switch {
+	case gpx != "":
+		return models.ParseGpx([]byte(gpx))
+	case polyline != "":
+		return models.DecodePolyline(polyline)
 	default:
+		return nil, models.ErrEmptyRoute
+	}
+}
+
+// POI sites along a route, given as GPX file or encoded polyline
+type routePoiData struct {
+	Category string `json:"category"`
+	Gpx      string `json:"gpx"`
+	Polyline string `json:"polyline"`
+	// Width (in km) of the corridor on either side of the route
+	Corridor float64 `json:"corridor"`
+	// Current position of the rider, defaults to the start of the route
+	Lon     *float64 `json:"lon"`
+	Lat     *float64 `json:"lat"`
+	OpenNow bool     `json:"open_now"`
+}
+
+const (
+	defaultRouteCorridor = 2.0
+	// Narrower corridors need too many lookups along the route
+	minRouteCorridor = 0.1
+	maxRouteCorridor = 10.0
+	// Maximum number of points of the parsed route
+	maxRoutePoints = 50000
+	// Maximum size of the request body, GPX files of long tours are large
+	maxRouteBodySize = 10 << 20
+)
+
+type routePoiHandler struct {
+	service    services.PoiService
+	categories services.PoiCategories
+	timezones  *timezone.Resolver
+	elevation  services.ElevationService
+}
+
+func NewRoutePoiHandler(service services.PoiService, categories services.PoiCategories, timezones *timezone.Resolver, elevation services.ElevationService) *routePoiHandler {
+	return &routePoiHandler{
+		service:    service,
+		categories: categories,
+		timezones:  timezones,
+		elevation:  elevation,
+	}
+}
+
+func (h *routePoiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var data routePoiData
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRouteBodySize)
+	err := json.NewDecoder(r.Body).Decode(&data)
+
+	if err != nil {
+		http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := h.categories.Get(data.Category); !ok {
 		http.Error(w, "unknown category", http.StatusBadRequest)
 		return
 	}
 
+	route, err := parseRoute(data.Gpx, data.Polyline)
 	if err != nil {
-		log.Println("Cloud not fetch sites data:", err)
+		http.Error(w, "invalid route: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(route) > maxRoutePoints {
+		http.Error(w, "route has too many points", http.StatusBadRequest)
+		return
+	}
+
+	corridor := data.Corridor
+	if corridor <= 0 {
+		corridor = defaultRouteCorridor
+	}
+	corridor = min(max(corridor, minRouteCorridor), maxRouteCorridor)
+
+	position := route[0]
+	if data.Lon != nil && data.Lat != nil {
+		position = models.Location{Lon: models.Coordinate(*data.Lon), Lat: models.Coordinate(*data.Lat)}
+	}
+
+	poiResults, err := h.service.GetPoisAlongRoute(data.Category, route, corridor, position)
+
+	if err != nil {
+		log.Println("Could not fetch sites along route:", err)
 		http.Error(w, "Error fetching sites", http.StatusInternalServerError)
 		return
 	}
 
+	poiResults.EvaluateOpeningHours(time.Now(), h.timezones.Lookup)
+	if data.OpenNow {
+		poiResults.RemoveClosed()
+	}
+
+	// The great-circle line from the rider is not the way along the route,
+	// so only the elevation is added
+	if h.elevation != nil {
+		poiResults.EvaluateElevation(nil, h.elevation.Elevation)
+	}
+
+	userLocale := locale.FromRequest(r)
+	poiResults.Localize(userLocale)
+	setLocaleHeaders(w, userLocale)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(poiResults)
 }
+
+// Details of a single POI, the path contains the OSM type and id, e.g.
+// /data/poi/node/123
+type poiDetailsHandler struct {
+	service services.PoiService
+}
+
+func NewPoiDetailsHandler(service services.PoiService) *poiDetailsHandler {
+	return &poiDetailsHandler{
+		service: service,
+	}
+}
+
+func (h *poiDetailsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	osmType := r.PathValue("osm_type")
+	if !services.ValidOsmType(osmType) {
+		http.Error(w, "invalid OSM type", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid OSM id", http.StatusBadRequest)
+		return
+	}
+
+	details, err := h.service.GetPoiDetails(osmType, id)
+	if errors.Is(err, services.ErrPoiNotFound) {
+		http.Error(w, "POI not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Could not fetch POI details:", err)
+		http.Error(w, "Error fetching POI details", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(details)
+}
+
+// POI categories
+type categoriesHandler struct {
+	categories services.PoiCategories
+}
+
+type categoryResponse struct {
+	Name string   `json:"name"`
+	Icon string   `json:"icon"`
+	Tags []string `json:"tags"`
+}
+
+func NewCategoriesHandler(categories services.PoiCategories) *categoriesHandler {
+	return &categoriesHandler{
+		categories: categories,
+	}
+}
+
+func (h *categoriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := []categoryResponse{}
+
+	for _, category := range h.categories {
+		response = append(response, categoryResponse{
+			Name: category.Name,
+			Icon: category.Icon,
+			Tags: category.Tags,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
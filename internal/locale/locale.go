@@ -0,0 +1,218 @@
+// Package locale selects the language and unit system of API responses and
+// provides the conversions and translated texts.
+//
+// Values are calculated in metric units (°C, km/h, km, mm) and converted
+// just before they are returned.
+package locale
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Units string
+
+const (
+	Metric Units = "metric"
+	// Miles, mph, °F and inches
+	Imperial Units = "imperial"
+)
+
+// Supported languages, the first one is the default
+var languages = []string{"en", "de"}
+
+type Locale struct {
+	Lang  string
+	Units Units
+}
+
+var Default = Locale{Lang: "en", Units: Metric}
+
+// Labels of the units, so that clients do not need to know the unit system
+type UnitLabels struct {
+	Temperature   string `json:"temperature"`
+	Speed         string `json:"speed"`
+	Distance      string `json:"distance"`
+	Precipitation string `json:"precipitation"`
+}
+
+// Reads the locale from the "lang" and "units" query parameters. A missing
+// language is derived from the Accept-Language header. Units are only
+// switched explicitly, clients that don't render the returned unit labels
+// keep getting metric values.
+func FromRequest(r *http.Request) Locale {
+	locale := Default
+
+	if lang := parseAcceptLanguage(r.Header.Get("Accept-Language")); lang != "" {
+		locale.Lang = lang
+	}
+
+	query := r.URL.Query()
+	if lang := strings.ToLower(query.Get("lang")); slices.Contains(languages, lang) {
+		locale.Lang = lang
+	}
+	switch Units(strings.ToLower(query.Get("units"))) {
+	case Metric:
+		locale.Units = Metric
+	case Imperial:
+		locale.Units = Imperial
+	}
+
+	return locale
+}
+
+// Returns the supported language with the highest quality, or an empty
+// string, if none is supported.
+func parseAcceptLanguage(header string) string {
+	var lang string
+	bestQuality := 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			quality, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if !slices.Contains(languages, primary) || quality <= bestQuality {
+			continue
+		}
+
+		bestQuality = quality
+		lang = primary
+	}
+
+	return lang
+}
+
+func (l Locale) Labels() UnitLabels {
+	if l.Units == Imperial {
+		return UnitLabels{Temperature: "°F", Speed: "mph", Distance: "mi", Precipitation: "in"}
+	}
+	return UnitLabels{Temperature: "°C", Speed: "km/h", Distance: "km", Precipitation: "mm"}
+}
+
+// Converts a temperature in Degree Celsius.
+func (l Locale) Temperature(celsius float64) float64 {
+	if l.Units == Imperial {
+		return celsius*9/5 + 32
+	}
+	return celsius
+}
+
+// Converts a speed in km/h.
+func (l Locale) Speed(kmh float64) float64 {
+	if l.Units == Imperial {
+		return kmh / 1.609344
+	}
+	return kmh
+}
+
+// Converts a distance in km.
+func (l Locale) Distance(km float64) float64 {
+	if l.Units == Imperial {
+		return km / 1.609344
+	}
+	return km
+}
+
+// Converts an amount of precipitation in mm.
+func (l Locale) Precipitation(mm float64) float64 {
+	if l.Units == Imperial {
+		return mm / 25.4
+	}
+	return mm
+}
+
+// Formats a distance in km without unit, with one decimal place under 2 units
+// and the decimal separator of the language.
+func (l Locale) DistanceText(km float64) string {
+	distance := l.Distance(km)
+
+	text := strconv.FormatFloat(distance, 'f', 0, 64)
+	if distance < 2 {
+		text = strconv.FormatFloat(distance, 'f', 1, 64)
+	}
+
+	if l.Lang == "de" {
+		text = strings.Replace(text, ".", ",", 1)
+	}
+	return text
+}
+
+// Upper limits of the Beaufort forces 0 to 11 in km/h, everything above is
+// force 12
+var beaufortLimits = []float64{1, 6, 12, 20, 29, 39, 50, 62, 75, 89, 103, 118}
+
+// Returns the Beaufort force of a wind speed in km/h.
+func Beaufort(kmh float64) int64 {
+	for force, limit := range beaufortLimits {
+		if math.Round(kmh) < limit {
+			return int64(force)
+		}
+	}
+	return 12
+}
+
+var texts = map[string]map[string][]string{
+	"en": {
+		"rain": {"dry", "light", "medium", "heavy"},
+		"beaufort": {"calm", "light air", "light breeze", "gentle breeze", "moderate breeze",
+			"fresh breeze", "strong breeze", "near gale", "gale", "strong gale", "storm",
+			"violent storm", "hurricane"},
+	},
+	"de": {
+		"rain": {"trocken", "leicht", "mäßig", "stark"},
+		"beaufort": {"Windstille", "leiser Zug", "leichte Brise", "schwache Brise", "mäßige Brise",
+			"frische Brise", "starker Wind", "steifer Wind", "stürmischer Wind", "Sturm",
+			"schwerer Sturm", "orkanartiger Sturm", "Orkan"},
+	},
+}
+
+var alertHeadlines = map[string]map[string]string{
+	"en": {
+		"thunderstorm": "Thunderstorm",
+		"gust":         "Strong gusts",
+		"heat":         "Heat",
+		"frost":        "Frost",
+		"rain":         "Heavy rain",
+	},
+	"de": {
+		"thunderstorm": "Gewitter",
+		"gust":         "Starke Böen",
+		"heat":         "Hitze",
+		"frost":        "Frost",
+		"rain":         "Starkregen",
+	},
+}
+
+func (l Locale) text(kind string, index int64) string {
+	values := texts[l.Lang][kind]
+	if index < 0 || int(index) >= len(values) {
+		return ""
+	}
+	return values[index]
+}
+
+// Describes the rain intensity from 0 (dry) to 3 (heavy).
+func (l Locale) RainText(intensity int64) string {
+	return l.text("rain", intensity)
+}
+
+func (l Locale) BeaufortText(force int64) string {
+	return l.text("beaufort", force)
+}
+
+// Returns the headline of an alert derived from the forecast, e.g. "heat".
+func (l Locale) AlertHeadline(alertType string) string {
+	return alertHeadlines[l.Lang][alertType]
+}
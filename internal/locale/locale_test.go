@@ -0,0 +1,97 @@
+package locale
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		query          string
+		acceptLanguage string
+		expected       Locale
+	}{
+		{"", "", Locale{"en", Metric}},
+		{"", "de-DE,de;q=0.9,en;q=0.8", Locale{"de", Metric}},
+		// The region does not switch the units
+		{"", "fr-FR,en-US;q=0.7,de;q=0.5", Locale{"en", Metric}},
+		{"", "fr-FR", Locale{"en", Metric}},
+		{"", "en;q=0.5,de;q=0.6", Locale{"de", Metric}},
+		{"?units=imperial", "en-US", Locale{"en", Imperial}},
+		{"?lang=de&units=imperial", "en-GB", Locale{"de", Imperial}},
+		{"?lang=fr&units=nautical", "de", Locale{"de", Metric}},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/data/weather"+test.query, nil)
+		if test.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", test.acceptLanguage)
+		}
+
+		if locale := FromRequest(r); locale != test.expected {
+			t.Errorf("%q, %q: expected %+v, but got %+v", test.query, test.acceptLanguage, test.expected, locale)
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	imperial := Locale{"en", Imperial}
+
+	tests := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"temperature", imperial.Temperature(20), 68},
+		{"speed", imperial.Speed(100), 62.137},
+		{"distance", imperial.Distance(1.609344), 1},
+		{"precipitation", imperial.Precipitation(25.4), 1},
+		{"metric", Default.Speed(100), 100},
+	}
+
+	for _, test := range tests {
+		if math.Abs(test.value-test.expected) > 0.001 {
+			t.Errorf("%s: expected %v, but got %v", test.name, test.expected, test.value)
+		}
+	}
+}
+
+func TestTexts(t *testing.T) {
+	german := Locale{"de", Metric}
+
+	if text := german.DistanceText(1.55); text != "1,6" {
+		t.Errorf("expected 1,6, but got %s", text)
+	}
+	if text := (Locale{"en", Imperial}).DistanceText(16.1); text != "10" {
+		t.Errorf("expected 10, but got %s", text)
+	}
+	if text := german.RainText(3); text != "stark" {
+		t.Errorf("expected stark, but got %s", text)
+	}
+	if text := Default.RainText(4); text != "" {
+		t.Errorf("expected no text for unknown intensity, but got %s", text)
+	}
+	if text := german.AlertHeadline("gust"); text != "Starke Böen" {
+		t.Errorf("expected Starke Böen, but got %s", text)
+	}
+}
+
+func TestBeaufort(t *testing.T) {
+	tests := []struct {
+		kmh   float64
+		force int64
+	}{
+		{0, 0}, {0.9, 1}, {5, 1}, {6, 2}, {19.4, 3}, {28.6, 5}, {50, 7}, {117, 11}, {150, 12},
+	}
+
+	for _, test := range tests {
+		if force := Beaufort(test.kmh); force != test.force {
+			t.Errorf("%v km/h: expected force %d, but got %d", test.kmh, test.force, force)
+		}
+	}
+
+	if text := Default.BeaufortText(6); text != "strong breeze" {
+		t.Errorf("expected strong breeze, but got %s", text)
+	}
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/locale"
+)
+
+// Severities in increasing order, like in the Common Alerting Protocol (CAP)
+var alertSeverities = []string{"minor", "moderate", "severe", "extreme"}
+
+// Weather warning, either derived from the forecast or an official warning of
+// the alert provider
+type Alert struct {
+	// One of thunderstorm, gust, heat, frost, rain or official
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	Start    time.Time `json:"start"`
+	// Missing for official warnings until further notice
+	End time.Time `json:"end,omitzero"`
+	// Only official warnings have a description
+	Headline    string `json:"headline,omitempty"`
+	Description string `json:"description,omitempty"`
+	// "forecast" or the name of the alert provider
+	Source string `json:"source"`
+}
+
+// Returns whether the alert is active at some time between start and end.
+func (a Alert) Overlaps(start time.Time, end time.Time) bool {
+	return a.Start.Before(end) && (a.End.IsZero() || a.End.After(start))
+}
+
+// Returns whether the severity is more severe than the other one. Unknown
+// severities are the least severe.
+func moreSevere(severity string, other string) bool {
+	return slices.Index(alertSeverities, severity) > slices.Index(alertSeverities, other)
+}
+
+// Thresholds for gusts in km/h, following the DWD warning levels
+func gustSeverity(gust float64) string {
+	switch {
+	case gust >= 105:
+		return "extreme"
+	case gust >= 75:
+		return "severe"
+	case gust >= 65:
+		return "moderate"
+	case gust >= 50:
+		return "minor"
+	default:
+		return ""
+	}
+}
+
+func thunderstormSeverity(conditionId int64) string {
+	switch {
+	case conditionId/100 != 2:
+		return ""
+	// Heavy and ragged thunderstorms
+	case conditionId == 202 || conditionId == 212 || conditionId == 221:
+		return "severe"
+	default:
+		return "moderate"
+	}
+}
+
+func heatSeverity(temperature float64) string {
+	switch {
+	case temperature >= 38:
+		return "extreme"
+	case temperature >= 35:
+		return "severe"
+	case temperature >= 30:
+		return "moderate"
+	default:
+		return ""
+	}
+}
+
+func frostSeverity(temperature float64) string {
+	switch {
+	case temperature <= -10:
+		return "moderate"
+	case temperature <= 0:
+		return "minor"
+	default:
+		return ""
+	}
+}
+
+// Likely rain, that is not only a few drops
+func rainSeverity(pop float64, rain float64) string {
+	switch {
+	case pop >= 0.8 && rain >= 10:
+		return "moderate"
+	case pop >= 0.8 && rain >= 1:
+		return "minor"
+	default:
+		return ""
+	}
+}
+
+// Derives warnings from the forecast blocks. Consecutive blocks with the same
+// type of warning are merged into one alert with the highest severity.
+func NewForecastAlerts(blocks []ForecastBlock) []Alert {
+	alerts := []Alert{}
+
+	checks := []struct {
+		alertType string
+		severity  func(block ForecastBlock) string
+	}{
+		{"thunderstorm", func(b ForecastBlock) string { return thunderstormSeverity(b.ConditionId) }},
+		{"gust", func(b ForecastBlock) string { return gustSeverity(b.WindGust) }},
+		{"heat", func(b ForecastBlock) string { return heatSeverity(b.Temperature) }},
+		{"frost", func(b ForecastBlock) string { return frostSeverity(b.Temperature) }},
+		{"rain", func(b ForecastBlock) string { return rainSeverity(b.Pop, b.Rain) }},
+	}
+
+	for _, check := range checks {
+		// Index of the alert of the previous block, if any
+		current := -1
+
+		for _, block := range blocks {
+			severity := check.severity(block)
+			if severity == "" {
+				current = -1
+				continue
+			}
+
+			end := block.Time.Add(forecastBlockDuration)
+
+			if current >= 0 {
+				alerts[current].End = end
+				if moreSevere(severity, alerts[current].Severity) {
+					alerts[current].Severity = severity
+				}
+				continue
+			}
+
+			alerts = append(alerts, Alert{
+				Type:     check.alertType,
+				Severity: severity,
+				Headline: locale.Default.AlertHeadline(check.alertType),
+				Start:    block.Time,
+				End:      end,
+				Source:   "forecast",
+			})
+			current = len(alerts) - 1
+		}
+	}
+
+	SortAlerts(alerts)
+
+	return alerts
+}
+
+// Sorts the alerts by start time, the most severe first.
+func SortAlerts(alerts []Alert) {
+	slices.SortStableFunc(alerts, func(a, b Alert) int {
+		if cmp := a.Start.Compare(b.Start); cmp != 0 {
+			return cmp
+		}
+		if moreSevere(a.Severity, b.Severity) {
+			return -1
+		}
+		if moreSevere(b.Severity, a.Severity) {
+			return 1
+		}
+		return 0
+	})
+}
@@ -0,0 +1,64 @@
+package models
+
+import "math"
+
+// Wind chill after the formula of Environment Canada, with the temperature in
+// Degree Celsius and the wind speed in km/h. Outside of the defined range
+// (above 10 °C or below 4.8 km/h), the temperature is returned.
+func WindChill(temp float64, windSpeed float64) float64 {
+	if temp > 10 || windSpeed < 4.8 {
+		return temp
+	}
+
+	v := math.Pow(windSpeed, 0.16)
+	return 13.12 + 0.6215*temp - 11.37*v + 0.3965*temp*v
+}
+
+// Heat index after the regression of Rothfusz, as used by the US National
+// Weather Service, with the temperature in Degree Celsius and the relative
+// humidity in percent. Below 27 °C, the temperature is returned.
+func HeatIndex(temp float64, humidity float64) float64 {
+	if temp < 27 || humidity <= 0 {
+		return temp
+	}
+
+	t := temp*9/5 + 32
+	rh := humidity
+
+	index := -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+		0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh +
+		0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+
+	switch {
+	case rh < 13 && t <= 112:
+		index -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+	case rh > 85 && t <= 87:
+		index += (rh - 85) / 10 * (87 - t) / 5
+	}
+
+	return (index - 32) * 5 / 9
+}
+
+// Dew point after the Magnus formula, with the temperature in Degree Celsius
+// and the relative humidity in percent.
+func DewPoint(temp float64, humidity float64) float64 {
+	const b, c = 17.62, 243.12
+
+	gamma := math.Log(humidity/100) + b*temp/(c+temp)
+	return c * gamma / (b - gamma)
+}
+
+// Speed of the air flowing past a rider in km/h. Averaged over the direction
+// of travel, wind and riding speed add up roughly like perpendicular vectors.
+func relativeWindSpeed(windSpeed float64, riderSpeed float64) float64 {
+	return math.Hypot(windSpeed, riderSpeed)
+}
+
+// Temperature felt by a rider at the given speed (in km/h): the wind chill
+// in the cold, the heat index in the heat and the temperature in between.
+func ApparentTemperature(temp float64, humidity float64, windSpeed float64, riderSpeed float64) float64 {
+	if temp >= 27 {
+		return HeatIndex(temp, humidity)
+	}
+	return WindChill(temp, relativeWindSpeed(windSpeed, riderSpeed))
+}
@@ -0,0 +1,115 @@
+package models
+
+import "math"
+
+// Returns the elevation in m at the location, or an error if it is unknown.
+type ElevationFunc func(lon float64, lat float64) (float64, error)
+
+const (
+	// Distance (in km) between the points of an elevation profile, about
+	// the resolution of SRTM data
+	elevationProfileSpacing = 0.1
+	// Climbs smaller than this (in m) are ignored, most of them are noise of
+	// the elevation model
+	ascentThreshold = 5.0
+)
+
+// Returns the point at the fraction of the great-circle line between the
+// locations.
+func (l1 Location) interpolate(l2 Location, fraction float64) Location {
+	lat1, lon1 := l1.Lat.toRadians(), l1.Lon.toRadians()
+	lat2, lon2 := l2.Lat.toRadians(), l2.Lon.toRadians()
+
+	// Central angle between the locations
+	angle := l1.distance(l2) / 6371.0
+	if angle == 0 {
+		return l1
+	}
+
+	a := math.Sin((1-fraction)*angle) / math.Sin(angle)
+	b := math.Sin(fraction*angle) / math.Sin(angle)
+
+	x := a*math.Cos(lat1)*math.Cos(lon1) + b*math.Cos(lat2)*math.Cos(lon2)
+	y := a*math.Cos(lat1)*math.Sin(lon1) + b*math.Cos(lat2)*math.Sin(lon2)
+	z := a*math.Sin(lat1) + b*math.Sin(lat2)
+
+	return Location{
+		Lon: Coordinate(math.Atan2(y, x) / math.Pi * 180),
+		Lat: Coordinate(math.Atan2(z, math.Hypot(x, y)) / math.Pi * 180),
+	}
+}
+
+// Returns the elevations (in m) along the great-circle line between the
+// locations, including both ends.
+func ElevationProfile(from Location, to Location, elevation ElevationFunc) ([]float64, error) {
+	count := int(math.Ceil(from.distance(to)/elevationProfileSpacing)) + 1
+	count = max(count, 2)
+
+	profile := make([]float64, count)
+	for i := range count {
+		point := from.interpolate(to, float64(i)/float64(count-1))
+
+		value, err := elevation(float64(point.Lon), float64(point.Lat))
+		if err != nil {
+			return nil, err
+		}
+		profile[i] = value
+	}
+
+	return profile, nil
+}
+
+// Returns the total ascent (in m) of the profile.
+func Ascent(profile []float64) float64 {
+	if len(profile) == 0 {
+		return 0
+	}
+
+	ascent := 0.0
+	// Lowest point since the last counted climb
+	reference := profile[0]
+
+	for _, value := range profile[1:] {
+		switch {
+		case value > reference+ascentThreshold:
+			ascent += value - reference
+			reference = value
+		case value < reference:
+			reference = value
+		}
+	}
+
+	// The climb at the end of the profile counts, even if it is smaller than
+	// the threshold, otherwise a steady ramp would lose its last metres
+	if last := profile[len(profile)-1]; last > reference {
+		ascent += last - reference
+	}
+
+	return ascent
+}
+
+// Sets the elevation of the sites and, if from is given, the ascent on the
+// way from there. Values stay missing, if the elevation is unknown.
+func (p OverpassSites) EvaluateElevation(from *Location, elevation ElevationFunc) {
+	for i := range p {
+		site := Location{Lon: Coordinate(p[i].Lon), Lat: Coordinate(p[i].Lat)}
+
+		siteElevation, err := elevation(p[i].Lon, p[i].Lat)
+		if err != nil {
+			continue
+		}
+		siteElevation = math.Round(siteElevation)
+		p[i].Elevation = &siteElevation
+
+		if from == nil {
+			continue
+		}
+
+		profile, err := ElevationProfile(*from, site, elevation)
+		if err != nil {
+			continue
+		}
+		ascent := math.Round(Ascent(profile))
+		p[i].Ascent = &ascent
+	}
+}
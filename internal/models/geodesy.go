@@ -0,0 +1,159 @@
+package models
+
+import (
+	"errors"
+	"math"
+)
+
+// Geodesy on the WGS84 ellipsoid after Vincenty, see
+// https://www.movable-type.co.uk/scripts/latlong-vincenty.html. Distances
+// are in km and bearings in degrees clockwise from north.
+
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+
+	vincentyTolerance     = 1e-12
+	vincentyMaxIterations = 200
+)
+
+// Vincenty's inverse solution fails for nearly antipodal points
+var ErrNoConvergence = errors.New("vincenty formula failed to converge")
+
+func toRadians(degrees float64) float64 {
+	return degrees / 180 * math.Pi
+}
+
+func toDegrees(radians float64) float64 {
+	return radians / math.Pi * 180
+}
+
+// Normalizes a bearing to [0, 360).
+func normalizeBearing(bearing float64) float64 {
+	return math.Mod(math.Mod(bearing, 360)+360, 360)
+}
+
+// Returns the geodesic distance between the locations and the initial and
+// final bearing of the geodesic.
+func Inverse(from Location, to Location) (distance float64, initialBearing float64, finalBearing float64, err error) {
+	lambdaL := toRadians(float64(to.Lon - from.Lon))
+
+	tanU1 := (1 - wgs84F) * math.Tan(from.Lat.toRadians())
+	cosU1 := 1 / math.Sqrt(1+tanU1*tanU1)
+	sinU1 := tanU1 * cosU1
+	tanU2 := (1 - wgs84F) * math.Tan(to.Lat.toRadians())
+	cosU2 := 1 / math.Sqrt(1+tanU2*tanU2)
+	sinU2 := tanU2 * cosU2
+
+	lambda := lambdaL
+	var sinLambda, cosLambda, sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+
+	converged := false
+	for range vincentyMaxIterations {
+		sinLambda, cosLambda = math.Sincos(lambda)
+
+		sinSqSigma := (cosU2*sinLambda)*(cosU2*sinLambda) +
+			(cosU1*sinU2-sinU1*cosU2*cosLambda)*(cosU1*sinU2-sinU1*cosU2*cosLambda)
+		sinSigma = math.Sqrt(sinSqSigma)
+		if sinSigma == 0 {
+			// Identical points
+			return 0, 0, 0, nil
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0
+		// Both points on the equator
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+
+		c := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+		previous := lambda
+		lambda = lambdaL + (1-c)*wgs84F*sinAlpha*
+			(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+
+		if math.Abs(lambda-previous) < vincentyTolerance {
+			converged = true
+			break
+		}
+	}
+
+	if !converged {
+		return 0, 0, 0, ErrNoConvergence
+	}
+
+	uSq := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+	a := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	b := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := b * sinSigma * (cos2SigmaM + b/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		b/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+	distance = wgs84B * a * (sigma - deltaSigma) / 1000
+
+	initialBearing = toDegrees(math.Atan2(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda))
+	finalBearing = toDegrees(math.Atan2(cosU1*sinLambda, -sinU1*cosU2+cosU1*sinU2*cosLambda))
+
+	return distance, normalizeBearing(initialBearing), normalizeBearing(finalBearing), nil
+}
+
+// Returns the location at the distance along the geodesic, that starts with
+// the bearing, and the final bearing there.
+func Direct(from Location, bearing float64, distance float64) (Location, float64) {
+	sinAlpha1, cosAlpha1 := math.Sincos(toRadians(bearing))
+
+	tanU1 := (1 - wgs84F) * math.Tan(from.Lat.toRadians())
+	cosU1 := 1 / math.Sqrt(1+tanU1*tanU1)
+	sinU1 := tanU1 * cosU1
+
+	sigma1 := math.Atan2(tanU1, cosAlpha1)
+	sinAlpha := cosU1 * sinAlpha1
+	cosSqAlpha := 1 - sinAlpha*sinAlpha
+	uSq := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+	a := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	b := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+
+	s := distance * 1000
+	sigma := s / (wgs84B * a)
+	var sinSigma, cosSigma, cos2SigmaM float64
+
+	for range vincentyMaxIterations {
+		cos2SigmaM = math.Cos(2*sigma1 + sigma)
+		sinSigma, cosSigma = math.Sincos(sigma)
+		deltaSigma := b * sinSigma * (cos2SigmaM + b/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+			b/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+		previous := sigma
+		sigma = s/(wgs84B*a) + deltaSigma
+		if math.Abs(sigma-previous) < vincentyTolerance {
+			break
+		}
+	}
+
+	sinSigma, cosSigma = math.Sincos(sigma)
+	cos2SigmaM = math.Cos(2*sigma1 + sigma)
+
+	x := sinU1*sinSigma - cosU1*cosSigma*cosAlpha1
+	lat := math.Atan2(sinU1*cosSigma+cosU1*sinSigma*cosAlpha1, (1-wgs84F)*math.Sqrt(sinAlpha*sinAlpha+x*x))
+	lambda := math.Atan2(sinSigma*sinAlpha1, cosU1*cosSigma-sinU1*sinSigma*cosAlpha1)
+	c := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+	l := lambda - (1-c)*wgs84F*sinAlpha*(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+
+	lon := math.Mod(float64(from.Lon)+toDegrees(l)+540, 360) - 180
+	finalBearing := toDegrees(math.Atan2(sinAlpha, -x))
+
+	return Location{Lon: Coordinate(lon), Lat: Coordinate(toDegrees(lat))}, normalizeBearing(finalBearing)
+}
+
+// Geodesic distance and initial bearing, falling back to the sphere for
+// nearly antipodal points.
+func geodesic(from Location, to Location) (distance float64, bearing float64) {
+	distance, bearing, _, err := Inverse(from, to)
+	if err != nil {
+		return from.distance(to), normalizeBearing(from.bearing(to))
+	}
+	return distance, bearing
+}
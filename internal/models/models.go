@@ -1,10 +1,13 @@
 package models
 
 import (
-	"fmt"
 	"math"
+	"slices"
 	"sort"
 	"time"
+
+	"github.com/leomfn/rueckenwind/internal/locale"
+	"github.com/leomfn/rueckenwind/internal/openinghours"
 )
 
 type Coordinate float64
@@ -86,6 +89,10 @@ func (w Wind) Scale() float64 {
 	return scale
 }
 
+func (w Wind) Beaufort() int64 {
+	return locale.Beaufort(w.Speed * 3.6)
+}
+
 type Rain struct {
 	ThreeHours float64 `json:"3h"`
 }
@@ -107,19 +114,7 @@ func (r Rain) RainIntensity() int64 {
 }
 
 func (r Rain) RainText() string {
-
-	switch r.RainIntensity() {
-	case 0:
-		return "dry"
-	case 1:
-		return "light"
-	case 2:
-		return "medium"
-	case 3:
-		return "heavy"
-	}
-
-	return ""
+	return locale.Default.RainText(r.RainIntensity())
 }
 
 type Clouds struct {
@@ -162,16 +157,13 @@ type WeatherForecast struct {
 	City    City            `json:"city"`
 }
 
-func (w WeatherForecast) SunsetLocalTime() string {
-	utcTime := time.Unix(int64(w.City.Sunset), 0).UTC()
-	return utcTime.Add(time.Duration(w.City.Timezone) * time.Second).Format("15:04")
-
-}
-
 type WeatherSummary struct {
 	// Temperature in Degree Celsius
 	CurrentTemperature int64 `json:"temp_current"`
 	FutureTemperature  int64 `json:"temp_future"`
+	// Felt by a rider, see WithRiderSpeed
+	CurrentApparentTemperature int64 `json:"temp_apparent_current"`
+	FutureApparentTemperature  int64 `json:"temp_apparent_future"`
 
 	// Wind speed in km/h
 	CurrentWindSpeed   int64   `json:"wind_current"`
@@ -182,13 +174,183 @@ type WeatherSummary struct {
 	FutureWindGust     int64   `json:"wind_gust_future"`
 	CurrentWindScale   float64 `json:"wind_scale_current"`
 	FutureWindScale    float64 `json:"wind_scale_future"`
-	CurrentRain        int64   `json:"rain_current"`
-	FutureRain         int64   `json:"rain_future"`
-	CurrentRainText    string  `json:"rain_current_text"`
-	FutureRainText     string  `json:"rain_future_text"`
-
-	// Local time
+	// Beaufort force and its description
+	CurrentBeaufort     int64  `json:"wind_beaufort_current"`
+	FutureBeaufort      int64  `json:"wind_beaufort_future"`
+	CurrentBeaufortText string `json:"wind_beaufort_current_text"`
+	FutureBeaufortText  string `json:"wind_beaufort_future_text"`
+	CurrentRain         int64  `json:"rain_current"`
+	FutureRain          int64  `json:"rain_future"`
+	CurrentRainText     string `json:"rain_current_text"`
+	FutureRainText      string `json:"rain_future_text"`
+
+	// Local time, see In
 	SunsetTime string `json:"sunset"`
+	// Reported by the provider, zero if unknown
+	Sunset time.Time `json:"-"`
+
+	// Name of the weather provider that answered the request
+	Source string `json:"source"`
+
+	// Units of the values, metric unless localized
+	Units locale.UnitLabels `json:"units"`
+
+	// Forecast blocks within the requested horizon, starting with the
+	// current one
+	Forecast []ForecastBlock `json:"forecast"`
+
+	// Warnings within the requested horizon
+	Alerts []Alert `json:"alerts"`
+
+	// Rain in short steps from now on, missing without nowcast provider
+	Nowcast []NowcastStep `json:"nowcast,omitempty"`
+
+	// Calculated for the location, independent of the provider
+	Sun SunTimes `json:"sun"`
+
+	// Unrounded current and future blocks, which Localize converts, see
+	// WithRiderSpeed
+	summaryBlocks []ForecastBlock
+}
+
+// Returns a copy of the summary with the forecast blocks that start before
+// the end of the horizon.
+func (w WeatherSummary) WithHorizon(now time.Time, horizon time.Duration) WeatherSummary {
+	end := now.Add(horizon)
+
+	blocks := []ForecastBlock{}
+	for _, block := range w.Forecast {
+		if block.Time.Before(end) {
+			blocks = append(blocks, block)
+		}
+	}
+
+	w.Forecast = blocks
+	return w
+}
+
+// Returns a copy of the summary with the wind chill and apparent temperature
+// of a rider at the given speed (in km/h). The current and future values are
+// taken from the first two blocks, so this must be called before WithHorizon.
+func (w WeatherSummary) WithRiderSpeed(riderSpeed float64) WeatherSummary {
+	blocks := make([]ForecastBlock, len(w.Forecast))
+	for i, block := range w.Forecast {
+		block.WindChill = WindChill(block.Temperature, relativeWindSpeed(block.WindSpeed, riderSpeed))
+		block.ApparentTemperature = ApparentTemperature(block.Temperature, float64(block.Humidity), block.WindSpeed, riderSpeed)
+		blocks[i] = block
+	}
+	w.Forecast = blocks
+
+	if len(blocks) >= 2 {
+		w.CurrentApparentTemperature = int64(math.Round(blocks[0].ApparentTemperature))
+		w.FutureApparentTemperature = int64(math.Round(blocks[1].ApparentTemperature))
+		w.summaryBlocks = slices.Clone(blocks[:2])
+	}
+
+	return w
+}
+
+// Returns a copy of the summary with the values converted into the units of
+// the locale and the texts translated.
+func (w WeatherSummary) Localize(l locale.Locale) WeatherSummary {
+	round := func(value float64) int64 {
+		return int64(math.Round(value))
+	}
+
+	// Converting the rounded values would round twice, they are only used
+	// without the unrounded blocks
+	current := ForecastBlock{
+		Temperature:         float64(w.CurrentTemperature),
+		ApparentTemperature: float64(w.CurrentApparentTemperature),
+		WindSpeed:           float64(w.CurrentWindSpeed),
+		WindGust:            float64(w.CurrentWindGust),
+	}
+	future := ForecastBlock{
+		Temperature:         float64(w.FutureTemperature),
+		ApparentTemperature: float64(w.FutureApparentTemperature),
+		WindSpeed:           float64(w.FutureWindSpeed),
+		WindGust:            float64(w.FutureWindGust),
+	}
+	if len(w.summaryBlocks) == 2 {
+		current, future = w.summaryBlocks[0], w.summaryBlocks[1]
+	}
+
+	w.CurrentTemperature = round(l.Temperature(current.Temperature))
+	w.FutureTemperature = round(l.Temperature(future.Temperature))
+	w.CurrentApparentTemperature = round(l.Temperature(current.ApparentTemperature))
+	w.FutureApparentTemperature = round(l.Temperature(future.ApparentTemperature))
+	w.CurrentWindSpeed = round(l.Speed(current.WindSpeed))
+	w.FutureWindSpeed = round(l.Speed(future.WindSpeed))
+	w.CurrentWindGust = round(l.Speed(current.WindGust))
+	w.FutureWindGust = round(l.Speed(future.WindGust))
+	w.CurrentRainText = l.RainText(w.CurrentRain)
+	w.FutureRainText = l.RainText(w.FutureRain)
+	w.CurrentBeaufortText = l.BeaufortText(w.CurrentBeaufort)
+	w.FutureBeaufortText = l.BeaufortText(w.FutureBeaufort)
+	w.Units = l.Labels()
+
+	blocks := make([]ForecastBlock, len(w.Forecast))
+	for i, block := range w.Forecast {
+		blocks[i] = block.localize(l)
+	}
+	w.Forecast = blocks
+
+	alerts := make([]Alert, len(w.Alerts))
+	for i, alert := range w.Alerts {
+		if alert.Source == "forecast" {
+			alert.Headline = l.AlertHeadline(alert.Type)
+		}
+		alerts[i] = alert
+	}
+	w.Alerts = alerts
+
+	if w.Nowcast != nil {
+		steps := make([]NowcastStep, len(w.Nowcast))
+		for i, step := range w.Nowcast {
+			step.Rain = l.Precipitation(step.Rain)
+			steps[i] = step
+		}
+		w.Nowcast = steps
+	}
+
+	return w
+}
+
+// Returns a copy of the summary with all times in the time zone of the
+// location. Without a sunset from the provider, the calculated one is used.
+func (w WeatherSummary) In(location *time.Location) WeatherSummary {
+	blocks := make([]ForecastBlock, len(w.Forecast))
+	for i, block := range w.Forecast {
+		block.Time = block.Time.In(location)
+		blocks[i] = block
+	}
+	w.Forecast = blocks
+
+	alerts := make([]Alert, len(w.Alerts))
+	for i, alert := range w.Alerts {
+		alert.Start = alert.Start.In(location)
+		alert.End = alert.End.In(location)
+		alerts[i] = alert
+	}
+	w.Alerts = alerts
+
+	if w.Nowcast != nil {
+		steps := make([]NowcastStep, len(w.Nowcast))
+		for i, step := range w.Nowcast {
+			step.Time = step.Time.In(location)
+			steps[i] = step
+		}
+		w.Nowcast = steps
+	}
+
+	switch {
+	case !w.Sunset.IsZero():
+		w.SunsetTime = w.Sunset.In(location).Format("15:04")
+	case w.Sun.Sunset != nil:
+		w.SunsetTime = w.Sun.Sunset.In(location).Format("15:04")
+	}
+
+	return w
 }
 
 type poi struct {
@@ -218,6 +380,9 @@ type cafeSite struct {
 }
 
 type overpassSite struct {
+	// OSM element, e.g. to request the details of the site
+	OsmType       string  `json:"osm_type"`
+	OsmId         int64   `json:"osm_id"`
 	Bearing       float64 `json:"bearing"`
 	Distance      float64 `json:"distance"`
 	DistanceText  string  `json:"distance_text"`
@@ -226,7 +391,58 @@ type overpassSite struct {
 	Website       string  `json:"website"`
 	Lon           float64 `json:"lon"`
 	Lat           float64 `json:"lat"`
-	Address       string  `json:"address"`
+	// Where the site can be entered, e.g. the entrance of a camp site or the
+	// nearest point of a park, the same as lon and lat for single nodes
+	AccessLon float64 `json:"access_lon"`
+	AccessLat float64 `json:"access_lat"`
+	Address   string  `json:"address"`
+	// Additional tags, as configured for the category
+	Tags map[string]string `json:"tags,omitempty"`
+	// Raw opening_hours tag and its evaluation, open_now is missing if the
+	// tag is missing or could not be parsed
+	OpeningHours string     `json:"opening_hours,omitempty"`
+	OpenNow      *bool      `json:"open_now,omitempty"`
+	NextChange   *time.Time `json:"next_change,omitempty"`
+	// Only set for searches along a route: distance (in km) along the route
+	// and additional distance to ride to the site and back
+	RouteDistance  *float64 `json:"route_distance,omitempty"`
+	DetourDistance *float64 `json:"detour_distance,omitempty"`
+	// Elevation of the site and ascent on the way there in m, missing
+	// without elevation data
+	Elevation *float64 `json:"elevation_m,omitempty"`
+	Ascent    *float64 `json:"ascent_m,omitempty"`
+	// Number of nearby sites, that were removed to avoid overlaps on the
+	// compass
+	HiddenCount int64 `json:"hidden_count"`
+}
+
+// All tags of a single POI, with the common ones normalized. Optional values
+// are missing, if the tag is missing or has an unknown value.
+type PoiDetails struct {
+	OsmType      string  `json:"osm_type"`
+	OsmId        int64   `json:"osm_id"`
+	Lon          float64 `json:"lon"`
+	Lat          float64 `json:"lat"`
+	Name         string  `json:"name,omitempty"`
+	Address      string  `json:"address,omitempty"`
+	Website      string  `json:"website,omitempty"`
+	Phone        string  `json:"phone,omitempty"`
+	Email        string  `json:"email,omitempty"`
+	Operator     string  `json:"operator,omitempty"`
+	OpeningHours string  `json:"opening_hours,omitempty"`
+	Fee          *bool   `json:"fee,omitempty"`
+	// Amount of the fee, e.g. "10 EUR"
+	Charge        string `json:"charge,omitempty"`
+	Capacity      *int64 `json:"capacity,omitempty"`
+	Tents         *bool  `json:"tents,omitempty"`
+	Shower        *bool  `json:"shower,omitempty"`
+	PowerSupply   *bool  `json:"power_supply,omitempty"`
+	DrinkingWater *bool  `json:"drinking_water,omitempty"`
+	// One of yes, limited or no
+	Wheelchair string `json:"wheelchair,omitempty"`
+	Surface    string `json:"surface,omitempty"`
+	// All tags of the element
+	Tags map[string]string `json:"tags"`
 }
 
 type Pois struct {
@@ -248,9 +464,80 @@ func newCampingSites() poisInterface {
 
 type OverpassSites []overpassSite
 
+// Sorts the sites by distance. Sites at the same distance are ordered by
+// their OSM element, so that the order is the same for every request.
 func (p *OverpassSites) SortByDistance() {
 	sort.Slice(*p, func(i, j int) bool {
-		return (*p)[i].Distance < (*p)[j].Distance
+		a, b := (*p)[i], (*p)[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		if a.OsmType != b.OsmType {
+			return a.OsmType < b.OsmType
+		}
+		return a.OsmId < b.OsmId
+	})
+}
+
+// Returns at most limit sites, starting at the offset, and the offset of the
+// next page. The next offset is 0, if there are no more sites. A limit of 0
+// returns all remaining sites.
+func (p OverpassSites) Page(offset int, limit int) (OverpassSites, int) {
+	if offset >= len(p) {
+		return OverpassSites{}, 0
+	}
+
+	end := len(p)
+	if limit > 0 && offset+limit < len(p) {
+		end = offset + limit
+	}
+
+	next := end
+	if end == len(p) {
+		next = 0
+	}
+
+	return p[offset:end], next
+}
+
+// Evaluates the opening hours of the sites at the given time, in the local
+// time zone of each site.
+func (p OverpassSites) EvaluateOpeningHours(now time.Time, zone func(lon float64, lat float64) *time.Location) {
+	for i := range p {
+		if p[i].OpeningHours == "" {
+			continue
+		}
+
+		hours, err := openinghours.Parse(p[i].OpeningHours)
+		if err != nil {
+			continue
+		}
+
+		open, nextChange := hours.State(now.In(zone(p[i].Lon, p[i].Lat)))
+		p[i].OpenNow = &open
+		if !nextChange.IsZero() {
+			p[i].NextChange = &nextChange
+		}
+	}
+}
+
+// Removes sites that are known to be closed. Sites without (valid) opening
+// hours are kept.
+func (p *OverpassSites) RemoveClosed() {
+	openSites := OverpassSites{}
+
+	for _, site := range *p {
+		if site.OpenNow == nil || *site.OpenNow {
+			openSites = append(openSites, site)
+		}
+	}
+
+	*p = openSites
+}
+
+func (p *OverpassSites) SortByRouteDistance() {
+	sort.SliceStable(*p, func(i, j int) bool {
+		return *(*p)[i].RouteDistance < *(*p)[j].RouteDistance
 	})
 }
 
@@ -294,55 +581,107 @@ func (p *Pois) filterByBearing() {
 	*p = filteredPois
 }
 
-func NewSite(siteLocation Location, referenceLocation Location, maxDistance int64) overpassSite {
-	distance := referenceLocation.distance(siteLocation)
-	var distanceText string
+// Converts the distances into the units of the locale.
+func (p OverpassSites) Localize(l locale.Locale) {
+	for i := range p {
+		p[i].DistanceText = l.DistanceText(p[i].Distance)
+		p[i].Distance = l.Distance(p[i].Distance)
+
+		if p[i].RouteDistance != nil {
+			routeDistance := l.Distance(*p[i].RouteDistance)
+			p[i].RouteDistance = &routeDistance
+		}
+		if p[i].DetourDistance != nil {
+			detourDistance := l.Distance(*p[i].DetourDistance)
+			p[i].DetourDistance = &detourDistance
+		}
+	}
+}
 
-	// Show first decimal place for distances under 2km
-	if distance < 2 {
-		distanceText = fmt.Sprintf("%.1f", distance)
-	} else {
-		distanceText = fmt.Sprintf("%.0f", distance)
+func NewSite(siteLocation Location, referenceLocation Location, maxDistance float64) overpassSite {
+	distance, bearing := geodesic(referenceLocation, siteLocation)
+	// Bearings of sites are between -180 and 180 degrees
+	if bearing > 180 {
+		bearing -= 360
 	}
 	maxPixel := 50.0
 	minPixel := 20.0
-	distancePixel := minPixel + (maxPixel-minPixel)*distance/float64(maxDistance)
+	distancePixel := minPixel + (maxPixel-minPixel)*distance/maxDistance
 
 	return overpassSite{
-		Bearing:       referenceLocation.bearing(siteLocation),
+		Bearing:       bearing,
 		Distance:      distance,
-		DistanceText:  distanceText,
+		DistanceText:  locale.Default.DistanceText(distance),
 		DistancePixel: distancePixel,
 		Lon:           float64(siteLocation.Lon),
 		Lat:           float64(siteLocation.Lat),
+		AccessLon:     float64(siteLocation.Lon),
+		AccessLat:     float64(siteLocation.Lat),
 	}
 }
 
-func (sites *OverpassSites) FilterByBearing() {
-	angleFractions := map[int]bool{
-		0:  false,
-		1:  false,
-		2:  false,
-		3:  false,
-		4:  false,
-		5:  false,
-		6:  false,
-		7:  false,
-		8:  false,
-		9:  false,
-		10: false,
-		11: false,
+// Sets the location, where the site can be entered.
+func (s *overpassSite) SetAccess(location Location) {
+	s.AccessLon = float64(location.Lon)
+	s.AccessLat = float64(location.Lat)
+}
+
+// Radius (in pixels) of the compass, outside of which the frontend draws the
+// sites at their distance in pixels
+const compassRadius = 75.0
+
+// Returns the position of the site on the compass in pixels, relative to the
+// center.
+func (site overpassSite) screenPosition() (float64, float64) {
+	radius := compassRadius + site.DistancePixel
+	bearing := site.Bearing / 180 * math.Pi
+
+	return radius * math.Sin(bearing), -radius * math.Cos(bearing)
+}
+
+// Removes sites that would overlap on the compass. Starting with the nearest,
+// a site is kept if it is at least minSeparation pixels away from all kept
+// sites, so there can be several sites in one direction at clearly different
+// distances. Removed sites are counted as hidden at the nearest kept site.
+func (sites *OverpassSites) Decluster(minSeparation float64) {
+	order := make([]int, len(*sites))
+	for i := range order {
+		order[i] = i
 	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return (*sites)[order[i]].Distance < (*sites)[order[j]].Distance
+	})
 
-	var filteredSites OverpassSites
+	// Indices of the kept sites
+	var kept []int
 
-	for _, site := range *sites {
-		angleFraction := int((site.Bearing + 180) / 30)
-		if !angleFractions[angleFraction] {
-			filteredSites = append(filteredSites, site)
-			angleFractions[angleFraction] = true
+	for _, i := range order {
+		x, y := (*sites)[i].screenPosition()
+
+		nearest := -1
+		nearestDistance := math.Inf(1)
+		for _, k := range kept {
+			keptX, keptY := (*sites)[k].screenPosition()
+			if distance := math.Hypot(x-keptX, y-keptY); distance < nearestDistance {
+				nearest, nearestDistance = k, distance
+			}
+		}
+
+		if nearest >= 0 && nearestDistance < minSeparation {
+			(*sites)[nearest].HiddenCount += 1 + (*sites)[i].HiddenCount
+			continue
 		}
+
+		kept = append(kept, i)
+	}
+
+	// Keep the original order
+	sort.Ints(kept)
+
+	declustered := OverpassSites{}
+	for _, i := range kept {
+		declustered = append(declustered, (*sites)[i])
 	}
 
-	*sites = filteredSites
+	*sites = declustered
 }
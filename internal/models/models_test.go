@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"math"
 	"testing"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/locale"
 )
 
 func TestLocation(t *testing.T) {
@@ -30,6 +33,60 @@ func TestLocation(t *testing.T) {
 	})
 }
 
+func TestGeodesy(t *testing.T) {
+	// Vincenty (1975) and the tables of Geoscience Australia
+	flindersPeak := Location{144.42486788888889, -37.95103341666667}
+	buninyong := Location{143.92649552777778, -37.65282113888889}
+
+	t.Run("Inverse", func(t *testing.T) {
+		tests := []struct {
+			name                         string
+			from, to                     Location
+			distance                     float64
+			initialBearing, finalBearing float64
+		}{
+			{"Flinders Peak to Buninyong", flindersPeak, buninyong, 54.972271, 306.868158, 307.173631},
+			{"quarter meridian", Location{0, 0}, Location{0, 90}, 10001.965729, 0, 0},
+			{"one degree on the equator", Location{0, 0}, Location{1, 0}, 111.319491, 90, 90},
+			{"identical points", Location{13.4, 52.5}, Location{13.4, 52.5}, 0, 0, 0},
+		}
+
+		for _, test := range tests {
+			distance, initialBearing, finalBearing, err := Inverse(test.from, test.to)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+
+			// Millimeters and hundredths of arc seconds
+			if math.Abs(distance-test.distance) > 1e-6 ||
+				math.Abs(initialBearing-test.initialBearing) > 1e-5 ||
+				math.Abs(finalBearing-test.finalBearing) > 1e-5 {
+				t.Errorf("%s: expected %.6f km, %.6f°, %.6f°, but got %.6f km, %.6f°, %.6f°", test.name,
+					test.distance, test.initialBearing, test.finalBearing, distance, initialBearing, finalBearing)
+			}
+		}
+
+		if _, _, _, err := Inverse(Location{0, 0}, Location{179.9, 0.5}); err != ErrNoConvergence {
+			t.Errorf("expected no convergence for nearly antipodal points, but got %v", err)
+		}
+	})
+
+	t.Run("Direct", func(t *testing.T) {
+		destination, finalBearing := Direct(flindersPeak, 306.868158, 54.972271)
+
+		if math.Abs(float64(destination.Lon-buninyong.Lon)) > 1e-7 ||
+			math.Abs(float64(destination.Lat-buninyong.Lat)) > 1e-7 ||
+			math.Abs(finalBearing-307.173631) > 1e-5 {
+			t.Errorf("expected %v, but got %v with final bearing %f", buninyong, destination, finalBearing)
+		}
+
+		// Across the antimeridian
+		if destination, _ := Direct(Location{179.5, 0}, 90, 111.319491); math.Abs(float64(destination.Lon)+179.5) > 1e-7 {
+			t.Errorf("expected -179.5, but got %v", destination)
+		}
+	})
+}
+
 func TestPois(t *testing.T) {
 	t.Run("sortByDistance", func(t *testing.T) {
 		pois := Pois{}
@@ -76,3 +133,583 @@ func TestPois(t *testing.T) {
 		}
 	})
 }
+
+func TestPage(t *testing.T) {
+	sites := OverpassSites{
+		{OsmType: "node", OsmId: 3, Distance: 2},
+		{OsmType: "way", OsmId: 1, Distance: 1},
+		{OsmType: "node", OsmId: 2, Distance: 1},
+		{OsmType: "node", OsmId: 1, Distance: 3},
+	}
+	sites.SortByDistance()
+
+	var ids []int64
+	offset := 0
+	for {
+		page, next := sites.Page(offset, 3)
+		for _, site := range page {
+			ids = append(ids, site.OsmId)
+		}
+		if next == 0 {
+			break
+		}
+		offset = next
+	}
+
+	if fmt.Sprint(ids) != "[2 1 3 1]" {
+		t.Errorf("expected sites 2, 1, 3 and 1 in order, but got %v", ids)
+	}
+
+	if page, next := sites.Page(0, 0); len(page) != 4 || next != 0 {
+		t.Errorf("expected all sites without limit, but got %d and next %d", len(page), next)
+	}
+	if page, next := sites.Page(10, 3); len(page) != 0 || next != 0 {
+		t.Errorf("expected no sites after the end, but got %d and next %d", len(page), next)
+	}
+}
+
+func TestDecluster(t *testing.T) {
+	site := func(bearing float64, distancePixel float64) overpassSite {
+		return overpassSite{Bearing: bearing, Distance: distancePixel, DistancePixel: distancePixel}
+	}
+
+	sites := OverpassSites{
+		site(0, 20),
+		// Same direction, clearly farther away
+		site(0, 50),
+		// Close to the first and second site
+		site(5, 22),
+		site(-3, 24),
+		site(2, 48),
+		// Across the bucket boundary of the former filter, but close
+		site(29, 30),
+		site(31, 30),
+		site(180, 35),
+	}
+
+	sites.Decluster(24)
+
+	expected := []struct {
+		bearing float64
+		hidden  int64
+	}{{0, 2}, {2, 1}, {29, 1}, {180, 0}}
+
+	if len(sites) != len(expected) {
+		t.Fatalf("expected %d sites, but got %+v", len(expected), sites)
+	}
+	for i, e := range expected {
+		if sites[i].Bearing != e.bearing || sites[i].HiddenCount != e.hidden {
+			t.Errorf("expected site at %v with %d hidden, but got %+v", e.bearing, e.hidden, sites[i])
+		}
+	}
+
+	all := OverpassSites{site(0, 20), site(1, 20)}
+	all.Decluster(0)
+	if len(all) != 2 {
+		t.Errorf("expected all sites without separation, but got %d", len(all))
+	}
+}
+
+func TestRoute(t *testing.T) {
+	t.Run("DecodePolyline", func(t *testing.T) {
+		route, err := DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := Route{{-120.2, 38.5}, {-120.95, 40.7}, {-126.453, 43.252}}
+		if len(route) != len(expected) {
+			t.Fatalf("expected %d points, but got %d", len(expected), len(route))
+		}
+		for i := range expected {
+			if math.Abs(float64(route[i].Lon-expected[i].Lon)) > 1e-9 || math.Abs(float64(route[i].Lat-expected[i].Lat)) > 1e-9 {
+				t.Fatalf("expected point %v, but got %v", expected[i], route[i])
+			}
+		}
+
+		if _, err := DecodePolyline("_p~iF~ps|U_"); err == nil {
+			t.Fatal("expected error for truncated polyline")
+		}
+	})
+
+	t.Run("ParseGpx", func(t *testing.T) {
+		route, err := ParseGpx([]byte(`<?xml version="1.0"?>
+			<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+				<trk><trkseg>
+					<trkpt lat="52.50" lon="13.40"><ele>34</ele></trkpt>
+					<trkpt lat="52.51" lon="13.41"></trkpt>
+				</trkseg><trkseg>
+					<trkpt lat="52.52" lon="13.42"></trkpt>
+				</trkseg></trk>
+			</gpx>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(route) != 3 || route[2] != (Location{13.42, 52.52}) {
+			t.Fatalf("unexpected route %v", route)
+		}
+
+		if _, err := ParseGpx([]byte(`<gpx></gpx>`)); err != ErrEmptyRoute {
+			t.Fatalf("expected empty route error, but got %v", err)
+		}
+	})
+
+	t.Run("Project", func(t *testing.T) {
+		// Along the equator, 1 degree is about 111.2 km
+		route := Route{{0, 0}, {1, 0}, {1, 1}}
+
+		along, offset := route.Project(Location{0.5, 0.01})
+		if math.Abs(along-55.6) > 0.1 || math.Abs(offset-1.112) > 0.01 {
+			t.Fatalf("unexpected projection %f, %f", along, offset)
+		}
+
+		along, offset = route.Project(Location{1.01, 0.5})
+		if math.Abs(along-166.8) > 0.1 || math.Abs(offset-1.112) > 0.01 {
+			t.Fatalf("unexpected projection on second segment %f, %f", along, offset)
+		}
+	})
+
+	t.Run("Simplify", func(t *testing.T) {
+		route := Route{{0, 0}, {0.5, 0.001}, {1, 0}, {1, 1}}
+
+		simplified := route.Simplify(0.5)
+		if len(simplified) != 3 || simplified[1] != (Location{1, 0}) {
+			t.Fatalf("unexpected simplified route %v", simplified)
+		}
+	})
+}
+
+func TestWindComponents(t *testing.T) {
+	tests := []struct {
+		heading, windDegrees float64
+		headwind, crosswind  float64
+		effect               string
+	}{
+		// Riding north, wind from the north
+		{0, 0, 20, 0, "headwind"},
+		// Riding north, wind from the south
+		{0, 180, -20, 0, "tailwind"},
+		// Riding east, wind from the south, i.e. from the right
+		{90, 180, 0, 20, "crosswind"},
+		// Riding west, wind from the south, i.e. from the left
+		{270, 180, 0, -20, "crosswind"},
+		// Riding south-west, wind from the north-east
+		{225, 45, -20, 0, "tailwind"},
+		{350, 20, 17.32, 10, "headwind"},
+	}
+
+	for _, test := range tests {
+		components := NewWindComponents(test.heading, 20, test.windDegrees)
+
+		if math.Abs(components.Headwind-test.headwind) > 0.01 ||
+			math.Abs(components.Crosswind-test.crosswind) > 0.01 ||
+			components.Effect != test.effect {
+			t.Errorf("heading %v, wind from %v: expected %v, %v, %s, but got %+v",
+				test.heading, test.windDegrees, test.headwind, test.crosswind, test.effect, components)
+		}
+	}
+}
+
+func TestRouteSegments(t *testing.T) {
+	// About 11.1 km between the points
+	route := Route{{0, 0}, {0.1, 0}, {0.2, 0}, {0.2, -0.1}}
+
+	segments := route.Segments(20)
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 segments, but got %d", len(segments))
+	}
+
+	if heading := segments[0].Heading(); math.Abs(heading-90) > 0.01 {
+		t.Errorf("expected heading 90, but got %f", heading)
+	}
+	if heading := segments[1].Heading(); math.Abs(heading-180) > 0.01 {
+		t.Errorf("expected heading 180, but got %f", heading)
+	}
+	if math.Abs(segments[1].StartDistance-22.24) > 0.01 || math.Abs(segments[1].Length-11.12) > 0.01 {
+		t.Errorf("unexpected second segment %+v", segments[1])
+	}
+}
+
+func TestRecommendation(t *testing.T) {
+	start := time.Date(2024, time.July, 1, 9, 0, 0, 0, time.UTC)
+
+	block := func(hours int, speed float64, degrees float64) ForecastBlock {
+		return ForecastBlock{Time: start.Add(time.Duration(hours) * time.Hour), WindSpeed: speed, WindDegrees: degrees}
+	}
+
+	t.Run("steady wind", func(t *testing.T) {
+		blocks := []ForecastBlock{block(0, 20, 270), block(3, 20, 270)}
+
+		recommendation, err := NewRecommendation(blocks, start, 4*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Ride west into the wind first
+		if recommendation.Bearing != 270 || recommendation.Reason != "into_wind_first" {
+			t.Fatalf("unexpected recommendation %+v", recommendation)
+		}
+		if recommendation.Outbound.Effect != "headwind" || recommendation.Return.Effect != "tailwind" {
+			t.Fatalf("expected headwind out and tailwind back, but got %+v", recommendation)
+		}
+		if math.Abs(recommendation.Advantage-40) > 0.01 {
+			t.Fatalf("expected advantage of 40 km/h, but got %f", recommendation.Advantage)
+		}
+	})
+
+	t.Run("wind shift", func(t *testing.T) {
+		// Light easterly wind in the morning, strong northerly wind in the
+		// afternoon
+		blocks := []ForecastBlock{block(0, 2, 90), block(3, 30, 0)}
+
+		recommendation, err := NewRecommendation(blocks, start, 6*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Ride north, so that the afternoon wind pushes back south
+		if recommendation.Bearing > 10 || recommendation.Reason != "wind_shift" {
+			t.Fatalf("unexpected recommendation %+v", recommendation)
+		}
+		if math.Abs(recommendation.Return.WindSpeed-30) > 0.01 {
+			t.Fatalf("expected return wind of 30 km/h, but got %f", recommendation.Return.WindSpeed)
+		}
+	})
+
+	t.Run("calm", func(t *testing.T) {
+		// The last block is used beyond the end of the forecast
+		recommendation, _ := NewRecommendation([]ForecastBlock{block(0, 3, 180)}, start, 8*time.Hour)
+		if recommendation.Reason != "calm" {
+			t.Fatalf("expected calm, but got %s", recommendation.Reason)
+		}
+	})
+
+	if _, err := NewRecommendation(nil, start, time.Hour); err != ErrNoForecast {
+		t.Fatalf("expected no forecast error, but got %v", err)
+	}
+}
+
+func TestWeatherSummaryWithHorizon(t *testing.T) {
+	now := time.Date(2024, time.July, 1, 10, 0, 0, 0, time.UTC)
+
+	summary := WeatherSummary{CurrentTemperature: 20}
+	for i := range 16 {
+		summary.Forecast = append(summary.Forecast, ForecastBlock{Time: now.Add(time.Duration(3*i-1) * time.Hour)})
+	}
+
+	trimmed := summary.WithHorizon(now, 12*time.Hour)
+
+	// The current block started before now
+	if len(trimmed.Forecast) != 5 || trimmed.CurrentTemperature != 20 {
+		t.Fatalf("expected 5 blocks, but got %d", len(trimmed.Forecast))
+	}
+	if len(summary.Forecast) != 16 {
+		t.Fatalf("expected the original summary to be unchanged")
+	}
+}
+
+func TestWeatherSummaryIn(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sunset := time.Date(2024, time.July, 1, 19, 30, 0, 0, time.UTC)
+	summary := WeatherSummary{
+		Sunset:   sunset,
+		Forecast: []ForecastBlock{{Time: sunset}},
+		Alerts:   []Alert{{Start: sunset, End: sunset.Add(time.Hour)}},
+	}
+
+	local := summary.In(berlin)
+
+	if local.SunsetTime != "21:30" {
+		t.Errorf("expected sunset at 21:30 CEST, but got %s", local.SunsetTime)
+	}
+	if local.Forecast[0].Time.Location() != berlin || local.Alerts[0].End.Location() != berlin {
+		t.Errorf("expected times in Europe/Berlin")
+	}
+	if summary.Forecast[0].Time.Location() != time.UTC {
+		t.Errorf("expected the original summary to be unchanged")
+	}
+
+	// Without a sunset from the provider, the calculated one is used
+	calculated := time.Date(2024, time.January, 15, 15, 30, 0, 0, time.UTC)
+	summary = WeatherSummary{Sun: SunTimes{Sunset: &calculated}}
+	if local := summary.In(berlin); local.SunsetTime != "16:30" {
+		t.Errorf("expected sunset at 16:30 CET, but got %s", local.SunsetTime)
+	}
+}
+
+func TestComfortIndices(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		// Tables of Environment Canada and the National Weather Service
+		{"wind chill", WindChill(-10, 20), -17.9},
+		{"wind chill above 10 °C", WindChill(15, 30), 15},
+		{"wind chill without wind", WindChill(0, 3), 0},
+		{"heat index", HeatIndex(32.2, 70), 41.0},
+		{"heat index below 27 °C", HeatIndex(20, 90), 20},
+		{"dew point", DewPoint(20, 50), 9.3},
+		{"dew point saturated", DewPoint(15, 100), 15},
+		// Riding at 20 km/h without wind
+		{"apparent temperature", ApparentTemperature(5, 80, 0, 20), 1.1},
+		{"apparent temperature in the heat", ApparentTemperature(32.2, 70, 10, 20), 41.0},
+	}
+
+	for _, test := range tests {
+		if math.Abs(test.value-test.expected) > 0.1 {
+			t.Errorf("%s: expected %.1f, but got %.2f", test.name, test.expected, test.value)
+		}
+	}
+}
+
+func TestWeatherSummaryWithRiderSpeed(t *testing.T) {
+	summary := WeatherSummary{Forecast: []ForecastBlock{
+		{Temperature: 5, WindSpeed: 15, Humidity: 80},
+		{Temperature: 20, WindSpeed: 15, Humidity: 80},
+	}}
+
+	riding := summary.WithRiderSpeed(20)
+
+	// 25 km/h of relative wind
+	if math.Abs(riding.Forecast[0].WindChill-0.5) > 0.1 {
+		t.Errorf("expected a wind chill of 0.5 °C, but got %.2f", riding.Forecast[0].WindChill)
+	}
+	if riding.CurrentApparentTemperature != 1 || riding.FutureApparentTemperature != 20 {
+		t.Errorf("expected apparent temperatures of 1 and 20 °C, but got %d and %d", riding.CurrentApparentTemperature, riding.FutureApparentTemperature)
+	}
+	if summary.Forecast[0].WindChill != 0 {
+		t.Errorf("expected the original summary to be unchanged")
+	}
+}
+
+func TestWeatherSummaryLocalize(t *testing.T) {
+	summary := WeatherSummary{
+		CurrentTemperature: 20,
+		CurrentWindSpeed:   50,
+		CurrentRain:        1,
+		CurrentBeaufort:    7,
+		Forecast:           []ForecastBlock{{Temperature: 20, WindSpeed: 50, Rain: 25.4}},
+		Alerts:             []Alert{{Type: "heat", Source: "forecast"}, {Type: "official", Headline: "Hitze", Source: "brightsky"}},
+	}
+
+	localized := summary.Localize(locale.Locale{Lang: "de", Units: locale.Imperial})
+
+	if localized.CurrentTemperature != 68 || localized.CurrentWindSpeed != 31 || localized.Units.Speed != "mph" {
+		t.Errorf("expected imperial units, but got %+v", localized)
+	}
+	if localized.CurrentRainText != "leicht" || localized.CurrentBeaufortText != "steifer Wind" {
+		t.Errorf("expected German texts, but got %s and %s", localized.CurrentRainText, localized.CurrentBeaufortText)
+	}
+	if block := localized.Forecast[0]; block.Temperature != 68 || math.Abs(block.Rain-1) > 1e-9 {
+		t.Errorf("expected converted block, but got %+v", block)
+	}
+	if localized.Alerts[0].Headline != "Hitze" || localized.Alerts[1].Headline != "Hitze" {
+		t.Errorf("expected translated forecast alerts, but got %+v", localized.Alerts)
+	}
+	if summary.Forecast[0].Temperature != 20 {
+		t.Errorf("expected the original summary to be unchanged")
+	}
+}
+
+func TestWeatherSummaryLocalizeUnrounded(t *testing.T) {
+	summary := WeatherSummary{
+		CurrentTemperature: 20,
+		FutureTemperature:  21,
+		Forecast:           []ForecastBlock{{Temperature: 20.4, WindSpeed: 12.4}, {Temperature: 21.3, WindSpeed: 12.4}},
+	}.WithRiderSpeed(0).WithHorizon(time.Unix(0, 0), 0)
+
+	localized := summary.Localize(locale.Locale{Lang: "en", Units: locale.Imperial})
+
+	// 20.4 °C are 68.72 °F, converting the rounded 20 °C would give 68 °F
+	if localized.CurrentTemperature != 69 || localized.FutureTemperature != 70 {
+		t.Errorf("expected temperatures 69/70, but got %d/%d", localized.CurrentTemperature, localized.FutureTemperature)
+	}
+	// 12.4 km/h are 7.71 mph, converting the rounded 12 km/h would give 7 mph
+	if localized.CurrentWindSpeed != 8 {
+		t.Errorf("expected wind speed 8 mph, but got %d", localized.CurrentWindSpeed)
+	}
+}
+
+func TestElevation(t *testing.T) {
+	// A hill of 100 m in the middle of the way, with some noise
+	hill := func(lon float64, lat float64) (float64, error) {
+		noise := 2 * math.Sin(lon*5000)
+		return 100*math.Sin((lon-13)*math.Pi/0.1) + noise, nil
+	}
+
+	from := Location{13, 52}
+	profile, err := ElevationProfile(from, Location{13.1, 52}, hill)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// About 6.9 km
+	if len(profile) != 70 {
+		t.Errorf("expected 70 points, but got %d", len(profile))
+	}
+	if ascent := Ascent(profile); math.Abs(ascent-100) > 5 {
+		t.Errorf("expected an ascent of about 100 m, but got %f", ascent)
+	}
+	// Each step of a steady ramp is below the threshold
+	if ascent := Ascent([]float64{0, 4, 8, 12}); ascent != 12 {
+		t.Errorf("expected an ascent of 12 m, but got %f", ascent)
+	}
+
+	sites := OverpassSites{{Lon: 13.05, Lat: 52}, {Lon: 14, Lat: 52}}
+	sites.EvaluateElevation(&from, func(lon float64, lat float64) (float64, error) {
+		if lon > 13.5 {
+			return 0, fmt.Errorf("no data")
+		}
+		return hill(lon, lat)
+	})
+
+	if sites[0].Elevation == nil || math.Abs(*sites[0].Elevation-100) > 2 || sites[0].Ascent == nil {
+		t.Errorf("expected elevation and ascent, but got %+v", sites[0])
+	}
+	if sites[1].Elevation != nil || sites[1].Ascent != nil {
+		t.Errorf("expected no elevation without data, but got %+v", sites[1])
+	}
+}
+
+func TestPolygon(t *testing.T) {
+	near := func(l1 Location, l2 Location) bool {
+		return math.Abs(float64(l1.Lon-l2.Lon)) < 1e-9 && math.Abs(float64(l1.Lat-l2.Lat)) < 1e-9
+	}
+
+	// The center of the bounding box would be at 13.15, 52.15
+	triangle := []Location{{13, 52}, {13.3, 52}, {13, 52.3}, {13, 52}}
+	if centroid, ok := Centroid([][]Location{triangle}, nil); !ok || !near(centroid, Location{13.1, 52.1}) {
+		t.Errorf("expected centroid of triangle at 13.1, 52.1, but got %v", centroid)
+	}
+
+	// Square with a hole in the north-east quarter
+	square := []Location{{13, 52}, {13, 52.2}, {13.2, 52.2}, {13.2, 52}, {13, 52}}
+	hole := []Location{{13.1, 52.1}, {13.2, 52.1}, {13.2, 52.2}, {13.1, 52.2}, {13.1, 52.1}}
+	if centroid, ok := Centroid([][]Location{square}, [][]Location{hole}); !ok || !near(centroid, Location{13 + 0.25/3, 52 + 0.25/3}) {
+		t.Errorf("expected centroid of square with hole at 13.083, 52.083, but got %v", centroid)
+	}
+
+	if _, ok := Centroid([][]Location{{{13, 52}, {13.1, 52}, {13, 52}}}, nil); ok {
+		t.Errorf("expected no centroid without area")
+	}
+
+	if nearest, ok := NearestPoint(Location{13.1, 51.9}, [][]Location{triangle}); !ok || !near(nearest, Location{13.1, 52}) {
+		t.Errorf("expected nearest point at 13.1, 52, but got %v", nearest)
+	}
+	if nearest, ok := NearestPoint(Location{12.9, 51.9}, [][]Location{triangle}); !ok || !near(nearest, Location{13, 52}) {
+		t.Errorf("expected nearest point at the corner, but got %v", nearest)
+	}
+
+	// A ring split into two ways, the second one in reverse direction
+	joined := JoinLines([][]Location{
+		{{13, 52}, {13.3, 52}},
+		{{13, 52}, {13, 52.3}, {13.3, 52}},
+	})
+	if len(joined) != 1 || !IsRing(joined[0]) || len(joined[0]) != 4 {
+		t.Errorf("expected a single ring, but got %v", joined)
+	}
+}
+
+func TestForecastAlerts(t *testing.T) {
+	start := time.Date(2024, time.July, 1, 9, 0, 0, 0, time.UTC)
+
+	blocks := []ForecastBlock{
+		{Time: start, Temperature: 29, WindGust: 40},
+		{Time: start.Add(3 * time.Hour), Temperature: 31, WindGust: 55},
+		{Time: start.Add(6 * time.Hour), Temperature: 36, WindGust: 80, ConditionId: 211, Pop: 0.9, Rain: 12},
+		{Time: start.Add(9 * time.Hour), Temperature: 28, WindGust: 30},
+	}
+
+	alerts := NewForecastAlerts(blocks)
+
+	expected := []Alert{
+		{Type: "gust", Severity: "severe", Start: start.Add(3 * time.Hour), End: start.Add(9 * time.Hour), Headline: "Strong gusts"},
+		{Type: "heat", Severity: "severe", Start: start.Add(3 * time.Hour), End: start.Add(9 * time.Hour), Headline: "Heat"},
+		{Type: "thunderstorm", Severity: "moderate", Start: start.Add(6 * time.Hour), End: start.Add(9 * time.Hour), Headline: "Thunderstorm"},
+		{Type: "rain", Severity: "moderate", Start: start.Add(6 * time.Hour), End: start.Add(9 * time.Hour), Headline: "Heavy rain"},
+	}
+
+	if len(alerts) != len(expected) {
+		t.Fatalf("expected %d alerts, but got %+v", len(expected), alerts)
+	}
+
+	for i, alert := range alerts {
+		alert.Source = ""
+		if alert != expected[i] {
+			t.Errorf("expected alert %+v, but got %+v", expected[i], alert)
+		}
+	}
+
+	if alerts := NewForecastAlerts(blocks[:1]); len(alerts) != 0 {
+		t.Errorf("expected no alerts, but got %+v", alerts)
+	}
+
+	official := Alert{Start: start}
+	if !official.Overlaps(start.Add(time.Hour), start.Add(2*time.Hour)) {
+		t.Errorf("expected open-ended alert to overlap")
+	}
+}
+
+func TestSunTimes(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTime := func(t *testing.T, name string, actual *time.Time, expected time.Time) {
+		t.Helper()
+
+		if actual == nil {
+			t.Fatalf("expected %s at %v, but got none", name, expected)
+		}
+		if difference := actual.Sub(expected).Abs(); difference > 2*time.Minute {
+			t.Errorf("expected %s at %v, but got %v", name, expected, actual)
+		}
+	}
+
+	t.Run("Berlin midsummer", func(t *testing.T) {
+		now := time.Date(2024, time.June, 21, 20, 0, 0, 0, berlin)
+		sun := NewSunTimes(Location{13.405, 52.52}, now)
+
+		checkTime(t, "sunrise", sun.Sunrise, time.Date(2024, time.June, 21, 4, 43, 0, 0, berlin))
+		checkTime(t, "sunset", sun.Sunset, time.Date(2024, time.June, 21, 21, 33, 0, 0, berlin))
+		checkTime(t, "civil dusk", sun.CivilDusk, time.Date(2024, time.June, 21, 22, 24, 0, 0, berlin))
+
+		if sun.NauticalDusk == nil || !sun.NauticalDusk.After(*sun.CivilDusk) {
+			t.Errorf("expected nautical dusk after civil dusk, but got %v", sun.NauticalDusk)
+		}
+		if sun.Timezone != "Europe/Berlin" || sun.TimezoneAbbreviation != "CEST" {
+			t.Errorf("unexpected time zone %s (%s)", sun.Timezone, sun.TimezoneAbbreviation)
+		}
+		if sun.RemainingDaylight == nil || math.Abs(float64(*sun.RemainingDaylight-144)) > 2 {
+			t.Errorf("expected about 144 minutes of daylight, but got %v", sun.RemainingDaylight)
+		}
+	})
+
+	t.Run("equator at equinox", func(t *testing.T) {
+		now := time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)
+		sun := NewSunTimes(Location{0, 0}, now)
+
+		checkTime(t, "sunrise", sun.Sunrise, time.Date(2024, time.March, 20, 6, 4, 0, 0, time.UTC))
+		checkTime(t, "sunset", sun.Sunset, time.Date(2024, time.March, 20, 18, 11, 0, 0, time.UTC))
+	})
+
+	t.Run("polar day and night", func(t *testing.T) {
+		tromso := Location{18.96, 69.65}
+
+		summer := NewSunTimes(tromso, time.Date(2024, time.June, 21, 12, 0, 0, 0, time.UTC))
+		if !summer.PolarDay || summer.Sunset != nil || summer.RemainingDaylight != nil {
+			t.Errorf("expected polar day, but got %+v", summer)
+		}
+
+		winter := NewSunTimes(tromso, time.Date(2024, time.December, 21, 12, 0, 0, 0, time.UTC))
+		if !winter.PolarNight || winter.Sunrise != nil || winter.CivilDusk == nil {
+			t.Errorf("expected polar night with civil twilight, but got %+v", winter)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Rain at a single step of the nowcast
+type NowcastStep struct {
+	Time time.Time `json:"time"`
+	// Rain rate in mm/h and its intensity from 0 (no rain) to 3 (heavy rain)
+	Rain          float64 `json:"rain"`
+	RainIntensity int64   `json:"rain_intensity"`
+}
+
+func NewNowcastStep(stepTime time.Time, rainRate float64) NowcastStep {
+	return NowcastStep{
+		Time:          stepTime,
+		Rain:          rainRate,
+		RainIntensity: Rain{ThreeHours: 3 * rainRate}.RainIntensity(),
+	}
+}
@@ -0,0 +1,150 @@
+package models
+
+import "math"
+
+// Polygons of OSM ways and relations. POIs are small compared to the earth,
+// so their geometry is computed in planar coordinates.
+
+// Converts planar coordinates in km relative to the reference location back
+// into a location.
+func (reference Location) fromPlanar(x float64, y float64) Location {
+	kmPerDegree := 111.2
+	return Location{
+		Lon: reference.Lon + Coordinate(x/(kmPerDegree*math.Cos(reference.Lat.toRadians()))),
+		Lat: reference.Lat + Coordinate(y/kmPerDegree),
+	}
+}
+
+// Returns true, if the line is closed and encloses an area.
+func IsRing(line []Location) bool {
+	return len(line) >= 4 && line[0] == line[len(line)-1]
+}
+
+// Returns the centroid of the polygon with the given outer and inner rings,
+// i.e. its center of mass. Returns false, if the polygon has no area.
+func Centroid(outer [][]Location, inner [][]Location) (Location, bool) {
+	var origin Location
+	for _, ring := range outer {
+		if len(ring) > 0 {
+			origin = ring[0]
+			break
+		}
+	}
+
+	var area, x, y float64
+
+	add := func(ring []Location, sign float64) {
+		// Shoelace formula, the orientation of the ring does not matter
+		var ringArea, ringX, ringY float64
+		for i := 1; i < len(ring); i++ {
+			x1, y1 := origin.planar(ring[i-1])
+			x2, y2 := origin.planar(ring[i])
+			cross := x1*y2 - x2*y1
+			ringArea += cross
+			ringX += (x1 + x2) * cross
+			ringY += (y1 + y2) * cross
+		}
+		if ringArea == 0 {
+			return
+		}
+
+		// Weighted by the absolute area, holes are subtracted
+		weight := sign * math.Abs(ringArea) / ringArea
+		area += weight * ringArea / 2
+		x += weight * ringX / 6
+		y += weight * ringY / 6
+	}
+
+	for _, ring := range outer {
+		add(ring, 1)
+	}
+	for _, ring := range inner {
+		add(ring, -1)
+	}
+
+	if area <= 0 {
+		return Location{}, false
+	}
+
+	return origin.fromPlanar(x/area, y/area), true
+}
+
+// Returns the point on the lines, that is nearest to the location. Returns
+// false, if there are no lines.
+func NearestPoint(location Location, lines [][]Location) (Location, bool) {
+	var nearestX, nearestY float64
+	found := false
+	minDistance := math.Inf(1)
+
+	for _, line := range lines {
+		for i := range line {
+			// Segment from a to b in planar coordinates around the location
+			bx, by := location.planar(line[i])
+			ax, ay := bx, by
+			if i > 0 {
+				ax, ay = location.planar(line[i-1])
+			}
+
+			dx, dy := bx-ax, by-ay
+			fraction := 0.0
+			if length := dx*dx + dy*dy; length > 0 {
+				fraction = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+			}
+			x, y := ax+fraction*dx, ay+fraction*dy
+
+			if distance := math.Hypot(x, y); distance < minDistance {
+				nearestX, nearestY, minDistance, found = x, y, distance, true
+			}
+		}
+	}
+
+	if !found {
+		return Location{}, false
+	}
+	return location.fromPlanar(nearestX, nearestY), true
+}
+
+// Joins the lines into as few lines as possible, by connecting lines with a
+// common end point. Multipolygons split their rings into several ways.
+func JoinLines(lines [][]Location) [][]Location {
+	var remaining [][]Location
+	for _, line := range lines {
+		if len(line) > 0 {
+			remaining = append(remaining, line)
+		}
+	}
+
+	var joined [][]Location
+	for len(remaining) > 0 {
+		current := append([]Location{}, remaining[0]...)
+		remaining = remaining[1:]
+
+		for !IsRing(current) {
+			end := current[len(current)-1]
+
+			next := -1
+			for i, line := range remaining {
+				if line[0] == end {
+					current = append(current, line[1:]...)
+					next = i
+					break
+				}
+				if line[len(line)-1] == end {
+					for j := len(line) - 2; j >= 0; j-- {
+						current = append(current, line[j])
+					}
+					next = i
+					break
+				}
+			}
+			if next < 0 {
+				break
+			}
+			remaining = append(remaining[:next], remaining[next+1:]...)
+		}
+
+		joined = append(joined, current)
+	}
+
+	return joined
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Average wind of one leg of a round trip, relative to its heading
+type LegWind struct {
+	Heading float64   `json:"heading"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	// Averages in km/h, the direction is the average of the wind vectors
+	WindSpeed   float64 `json:"wind_speed"`
+	WindDegrees float64 `json:"wind_deg"`
+	WindComponents
+}
+
+// Outbound direction of an out-and-back ride, that puts the headwind on the
+// way out and the tailwind on the way back
+type Recommendation struct {
+	Bearing  float64 `json:"bearing"`
+	Outbound LegWind `json:"outbound"`
+	Return   LegWind `json:"return"`
+	// Tailwind (in km/h) gained on the way back compared to the way out
+	Advantage float64 `json:"advantage"`
+	// Change of the average wind direction between the legs, in degrees
+	WindShift float64 `json:"wind_shift"`
+	// Why the bearing was chosen: calm, into_wind_first or wind_shift
+	Reason string `json:"reason"`
+}
+
+var ErrNoForecast = errors.New("no forecast blocks")
+
+// Wind below this speed (in km/h) doesn't matter for the direction
+const calmWindSpeed = 5.0
+
+// Length of a forecast block
+const forecastBlockDuration = 3 * time.Hour
+
+// Time weighted average of the wind vectors between start and end. Times
+// beyond the forecast use the last block.
+func averageWind(blocks []ForecastBlock, start time.Time, end time.Time) (speed float64, degrees float64) {
+	var u, v, totalWeight float64
+
+	for i, block := range blocks {
+		blockStart, blockEnd := block.Time, block.Time.Add(forecastBlockDuration)
+		if i == len(blocks)-1 && end.After(blockEnd) {
+			blockEnd = end
+		}
+		if start.After(blockStart) {
+			blockStart = start
+		}
+		if end.Before(blockEnd) {
+			blockEnd = end
+		}
+
+		overlap := blockEnd.Sub(blockStart)
+		if overlap <= 0 {
+			continue
+		}
+
+		weight := overlap.Hours()
+		angle := block.WindDegrees / 180 * math.Pi
+		u += weight * block.WindSpeed * math.Sin(angle)
+		v += weight * block.WindSpeed * math.Cos(angle)
+		totalWeight += weight
+	}
+
+	if totalWeight == 0 {
+		last := blocks[len(blocks)-1]
+		return last.WindSpeed, last.WindDegrees
+	}
+
+	u, v = u/totalWeight, v/totalWeight
+	return math.Hypot(u, v), math.Mod(math.Atan2(u, v)/math.Pi*180+360, 360)
+}
+
+func newLegWind(blocks []ForecastBlock, heading float64, start time.Time, end time.Time) LegWind {
+	speed, degrees := averageWind(blocks, start, end)
+
+	return LegWind{
+		Heading:        heading,
+		Start:          start,
+		End:            end,
+		WindSpeed:      speed,
+		WindDegrees:    degrees,
+		WindComponents: NewWindComponents(heading, speed, degrees),
+	}
+}
+
+// Recommends the outbound bearing for a round trip of the given duration,
+// starting at start. The first half of the ride is spent riding out, the
+// second half riding back on the opposite heading. Bearings are tried in
+// steps of 5 degrees.
+func NewRecommendation(blocks []ForecastBlock, start time.Time, duration time.Duration) (Recommendation, error) {
+	if len(blocks) == 0 {
+		return Recommendation{}, ErrNoForecast
+	}
+
+	turn := start.Add(duration / 2)
+	end := start.Add(duration)
+
+	var best Recommendation
+
+	for bearing := 0.0; bearing < 360; bearing += 5 {
+		outbound := newLegWind(blocks, bearing, start, turn)
+		back := newLegWind(blocks, math.Mod(bearing+180, 360), turn, end)
+
+		advantage := outbound.Headwind - back.Headwind
+		if bearing == 0 || advantage > best.Advantage {
+			best = Recommendation{
+				Bearing:   bearing,
+				Outbound:  outbound,
+				Return:    back,
+				Advantage: advantage,
+			}
+		}
+	}
+
+	shift := math.Abs(best.Outbound.WindDegrees - best.Return.WindDegrees)
+	best.WindShift = math.Min(shift, 360-shift)
+
+	switch {
+	case math.Max(best.Outbound.WindSpeed, best.Return.WindSpeed) < calmWindSpeed:
+		best.Reason = "calm"
+	case best.WindShift > 45:
+		best.Reason = "wind_shift"
+	default:
+		best.Reason = "into_wind_first"
+	}
+
+	return best, nil
+}
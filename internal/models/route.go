@@ -0,0 +1,262 @@
+package models
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Planned route as a line through its points
+type Route []Location
+
+var ErrEmptyRoute = errors.New("route has no points")
+
+type gpxPoint struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+type gpxFile struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Routes []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+// Reads the route from a GPX file. All track segments are joined, routes are
+// only used, if the file contains no tracks.
+func ParseGpx(data []byte) (Route, error) {
+	var file gpxFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid GPX: %w", err)
+	}
+
+	var route Route
+	for _, track := range file.Tracks {
+		for _, segment := range track.Segments {
+			for _, point := range segment.Points {
+				route = append(route, Location{Lon: Coordinate(point.Lon), Lat: Coordinate(point.Lat)})
+			}
+		}
+	}
+
+	if len(route) == 0 {
+		for _, gpxRoute := range file.Routes {
+			for _, point := range gpxRoute.Points {
+				route = append(route, Location{Lon: Coordinate(point.Lon), Lat: Coordinate(point.Lat)})
+			}
+		}
+	}
+
+	if len(route) == 0 {
+		return nil, ErrEmptyRoute
+	}
+
+	return route, nil
+}
+
+// Decodes a route in the encoded polyline format with a precision of 5
+// decimal places, as used by Google Maps, OSRM and others.
+func DecodePolyline(encoded string) (Route, error) {
+	var (
+		route    Route
+		lat, lon int64
+	)
+
+	readValue := func(i *int) (int64, error) {
+		var result, shift int64
+
+		for {
+			if *i >= len(encoded) {
+				return 0, errors.New("invalid polyline: unexpected end")
+			}
+
+			b := int64(encoded[*i]) - 63
+			*i++
+			if b < 0 || b > 63 {
+				return 0, errors.New("invalid polyline: invalid character")
+			}
+
+			result |= (b & 0x1f) << shift
+			shift += 5
+
+			if b < 0x20 {
+				break
+			}
+		}
+
+		if result&1 != 0 {
+			return ^(result >> 1), nil
+		}
+		return result >> 1, nil
+	}
+
+	for i := 0; i < len(encoded); {
+		deltaLat, err := readValue(&i)
+		if err != nil {
+			return nil, err
+		}
+		deltaLon, err := readValue(&i)
+		if err != nil {
+			return nil, err
+		}
+
+		lat += deltaLat
+		lon += deltaLon
+
+		route = append(route, Location{Lon: Coordinate(float64(lon) / 1e5), Lat: Coordinate(float64(lat) / 1e5)})
+	}
+
+	if len(route) == 0 {
+		return nil, ErrEmptyRoute
+	}
+
+	return route, nil
+}
+
+// Length of the route in km
+func (r Route) Length() float64 {
+	var length float64
+	for i := 1; i < len(r); i++ {
+		length += r[i-1].distance(r[i])
+	}
+	return length
+}
+
+// Converts the location into planar coordinates in km relative to the
+// reference location. Good enough for the short distances of a corridor.
+func (reference Location) planar(l Location) (x, y float64) {
+	kmPerDegree := 111.2
+	x = float64(l.Lon-reference.Lon) * kmPerDegree * math.Cos(reference.Lat.toRadians())
+	y = float64(l.Lat-reference.Lat) * kmPerDegree
+	return x, y
+}
+
+// Projects the location onto the route. Returns the distance along the route
+// to the nearest point of the route, and the distance between the location
+// and this point, both in km.
+func (r Route) Project(l Location) (along float64, offset float64) {
+	if len(r) == 0 {
+		return 0, math.Inf(1)
+	}
+
+	along, offset = 0, r[0].distance(l)
+
+	var start float64
+	for i := 1; i < len(r); i++ {
+		// Segment from a (origin) to b in planar coordinates around a
+		a, b := r[i-1], r[i]
+		bx, by := a.planar(b)
+		px, py := a.planar(l)
+
+		segmentLength := a.distance(b)
+		planarLength := bx*bx + by*by
+
+		fraction := 0.0
+		if planarLength > 0 {
+			fraction = math.Max(0, math.Min(1, (px*bx+py*by)/planarLength))
+		}
+
+		dx, dy := px-fraction*bx, py-fraction*by
+		if distance := math.Sqrt(dx*dx + dy*dy); distance < offset {
+			along, offset = start+fraction*segmentLength, distance
+		}
+
+		start += segmentLength
+	}
+
+	return along, offset
+}
+
+// Simplifies the route with the Douglas-Peucker algorithm, so that no point
+// of the route is farther than tolerance (in km) from the simplified line.
+//
+// Points closer than half the tolerance to the previous point are dropped
+// first. This takes linear time and removes most points of dense GPX tracks,
+// before Douglas-Peucker, which takes quadratic time in the worst case,
+// simplifies the rest with the other half of the tolerance.
+func (r Route) Simplify(tolerance float64) Route {
+	if len(r) < 3 {
+		return r
+	}
+
+	reduced := Route{r[0]}
+	for _, location := range r[1 : len(r)-1] {
+		if reduced[len(reduced)-1].distance(location) >= tolerance/2 {
+			reduced = append(reduced, location)
+		}
+	}
+	r = append(reduced, r[len(r)-1])
+	tolerance /= 2
+
+	keep := make([]bool, len(r))
+	keep[0], keep[len(r)-1] = true, true
+
+	// Ranges of points, that are still to be simplified. A stack instead of
+	// recursion, long tracks would nest deeply.
+	ranges := [][2]int{{0, len(r) - 1}}
+	for len(ranges) > 0 {
+		first, last := ranges[len(ranges)-1][0], ranges[len(ranges)-1][1]
+		ranges = ranges[:len(ranges)-1]
+
+		segment := Route{r[first], r[last]}
+
+		farthest, maxOffset := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if _, offset := segment.Project(r[i]); offset > maxOffset {
+				farthest, maxOffset = i, offset
+			}
+		}
+
+		if farthest >= 0 {
+			keep[farthest] = true
+			ranges = append(ranges, [2]int{first, farthest}, [2]int{farthest, last})
+		}
+	}
+
+	var simplified Route
+	for i, location := range r {
+		if keep[i] {
+			simplified = append(simplified, location)
+		}
+	}
+
+	return simplified
+}
+
+// Returns points along the route, with at most the given spacing (in km)
+// between them. Used to search the surroundings of the route in steps.
+func (r Route) Sample(spacing float64) Route {
+	if len(r) == 0 {
+		return nil
+	}
+
+	samples := Route{r[0]}
+	for i := 1; i < len(r); i++ {
+		a, b := r[i-1], r[i]
+		steps := int(math.Ceil(a.distance(b) / spacing))
+
+		for step := 1; step <= steps; step++ {
+			fraction := float64(step) / float64(steps)
+			samples = append(samples, Location{
+				Lon: a.Lon + Coordinate(fraction)*(b.Lon-a.Lon),
+				Lat: a.Lat + Coordinate(fraction)*(b.Lat-a.Lat),
+			})
+		}
+	}
+
+	return samples
+}
+
+// Sets the position of the site along the route. The detour is the additional
+// distance of riding from the route to the site and back.
+func (s *overpassSite) SetRoutePosition(routeDistance float64, offset float64) {
+	detour := 2 * offset
+	s.RouteDistance = &routeDistance
+	s.DetourDistance = &detour
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Sun times of a single day at a location. Times are missing, if the sun
+// doesn't reach the elevation on that day, e.g. in polar summer or winter.
+type SunTimes struct {
+	NauticalDawn *time.Time `json:"nautical_dawn"`
+	CivilDawn    *time.Time `json:"civil_dawn"`
+	Sunrise      *time.Time `json:"sunrise"`
+	Sunset       *time.Time `json:"sunset"`
+	CivilDusk    *time.Time `json:"civil_dusk"`
+	NauticalDusk *time.Time `json:"nautical_dusk"`
+	// The sun stays above or below the horizon for the whole day
+	PolarDay   bool `json:"polar_day,omitempty"`
+	PolarNight bool `json:"polar_night,omitempty"`
+	// Minutes until the end of civil dusk, when it gets too dark to ride
+	// without lights. Missing during the polar day.
+	RemainingDaylight *int64 `json:"remaining_daylight"`
+	// IANA name and abbreviation of the time zone of the times
+	Timezone             string `json:"timezone"`
+	TimezoneAbbreviation string `json:"timezone_abbreviation"`
+}
+
+// Elevations of the sun's centre in degrees. The sunrise accounts for the
+// refraction and the radius of the sun.
+const (
+	sunriseElevation  = -0.833
+	civilElevation    = -6.0
+	nauticalElevation = -12.0
+)
+
+// Julian date of the Unix epoch and of J2000
+const (
+	julianUnixEpoch = 2440587.5
+	julianJ2000     = 2451545.0
+)
+
+func toJulian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnixEpoch
+}
+
+func fromJulian(julian float64) time.Time {
+	seconds := (julian - julianUnixEpoch) * 86400
+	return time.Unix(int64(math.Round(seconds)), 0)
+}
+
+func sinDegrees(degrees float64) float64 {
+	return math.Sin(degrees / 180 * math.Pi)
+}
+
+func cosDegrees(degrees float64) float64 {
+	return math.Cos(degrees / 180 * math.Pi)
+}
+
+// Solar transit and declination of the day, see
+// https://en.wikipedia.org/wiki/Sunrise_equation
+type solarDay struct {
+	transit     float64 // Julian date
+	declination float64 // degrees
+	latitude    float64
+}
+
+func newSolarDay(location Location, date time.Time) solarDay {
+	year, month, day := date.Date()
+	noon := time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+
+	// Days since J2000 and mean solar time at the longitude
+	n := math.Round(toJulian(noon) - julianJ2000 + 0.0008)
+	meanSolarTime := n - float64(location.Lon)/360
+
+	meanAnomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	center := 1.9148*sinDegrees(meanAnomaly) + 0.02*sinDegrees(2*meanAnomaly) + 0.0003*sinDegrees(3*meanAnomaly)
+	eclipticLongitude := math.Mod(meanAnomaly+center+180+102.9372, 360)
+
+	transit := julianJ2000 + meanSolarTime + 0.0053*sinDegrees(meanAnomaly) - 0.0069*sinDegrees(2*eclipticLongitude)
+	declination := math.Asin(sinDegrees(eclipticLongitude)*sinDegrees(23.4397)) / math.Pi * 180
+
+	return solarDay{transit: transit, declination: declination, latitude: float64(location.Lat)}
+}
+
+// Returns the times at which the sun passes the elevation in the morning and
+// evening. The result is -1 or 1, if the sun stays below or above the
+// elevation for the whole day.
+func (d solarDay) crossing(elevation float64) (morning time.Time, evening time.Time, result int) {
+	cosHourAngle := (sinDegrees(elevation) - sinDegrees(d.latitude)*sinDegrees(d.declination)) /
+		(cosDegrees(d.latitude) * cosDegrees(d.declination))
+
+	switch {
+	case cosHourAngle > 1:
+		return time.Time{}, time.Time{}, -1
+	case cosHourAngle < -1:
+		return time.Time{}, time.Time{}, 1
+	}
+
+	hourAngle := math.Acos(cosHourAngle) / math.Pi * 180
+
+	return fromJulian(d.transit - hourAngle/360), fromJulian(d.transit + hourAngle/360), 0
+}
+
+// Calculates the sun times at the location for the day of now, in the time
+// zone of now. The remaining daylight is counted from now.
+func NewSunTimes(location Location, now time.Time) SunTimes {
+	day := newSolarDay(location, now)
+	zone, _ := now.Zone()
+
+	sun := SunTimes{
+		Timezone:             now.Location().String(),
+		TimezoneAbbreviation: zone,
+	}
+
+	set := func(elevation float64, dawn **time.Time, dusk **time.Time) int {
+		morning, evening, result := day.crossing(elevation)
+		if result == 0 {
+			morning, evening = morning.In(now.Location()), evening.In(now.Location())
+			*dawn, *dusk = &morning, &evening
+		}
+		return result
+	}
+
+	set(nauticalElevation, &sun.NauticalDawn, &sun.NauticalDusk)
+	civil := set(civilElevation, &sun.CivilDawn, &sun.CivilDusk)
+
+	switch set(sunriseElevation, &sun.Sunrise, &sun.Sunset) {
+	case 1:
+		sun.PolarDay = true
+	case -1:
+		sun.PolarNight = true
+	}
+
+	// Light all day, nothing remains to be counted
+	if civil == 1 {
+		return sun
+	}
+
+	var remaining int64
+	if civil == 0 && sun.CivilDusk.After(now) {
+		start := now
+		if sun.CivilDawn.After(now) {
+			start = *sun.CivilDawn
+		}
+		remaining = int64(sun.CivilDusk.Sub(start).Minutes())
+	}
+	sun.RemainingDaylight = &remaining
+
+	return sun
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/locale"
+)
+
+// Forecast values of a single 3-hour block
+type ForecastBlock struct {
+	Time time.Time `json:"time"`
+	// Temperature in Degree Celsius
+	Temperature float64 `json:"temp"`
+	// Felt by a rider, see WeatherSummary.WithRiderSpeed
+	WindChill           float64 `json:"wind_chill"`
+	HeatIndex           float64 `json:"heat_index"`
+	ApparentTemperature float64 `json:"temp_apparent"`
+	// Relative humidity in percent, the dew point is missing if the
+	// humidity is unknown
+	Humidity int64    `json:"humidity"`
+	DewPoint *float64 `json:"dew_point,omitempty"`
+	// Wind speed in km/h, the direction is where the wind comes from
+	WindSpeed   float64 `json:"wind_speed"`
+	WindDegrees float64 `json:"wind_deg"`
+	WindGust    float64 `json:"wind_gust"`
+	Beaufort    int64   `json:"wind_beaufort"`
+	// Precipitation within the block in mm, and its intensity from 0 (no
+	// rain) to 3 (heavy rain)
+	Rain          float64 `json:"rain"`
+	RainIntensity int64   `json:"rain_intensity"`
+	// Cloud cover in percent
+	Clouds int64 `json:"clouds"`
+	// Probability of precipitation from 0 to 1
+	Pop float64 `json:"pop"`
+	// OpenWeatherMap condition id, e.g. 2xx for thunderstorms, 0 if unknown
+	ConditionId int64 `json:"condition_id"`
+}
+
+func NewForecastBlock(entry ForecastEntry) ForecastBlock {
+	var conditionId int64
+	if len(entry.Weather) > 0 {
+		conditionId = entry.Weather[0].Id
+	}
+
+	block := ForecastBlock{
+		Time:          time.Unix(entry.Timestamp, 0).UTC(),
+		Temperature:   entry.Main.Temp,
+		HeatIndex:     HeatIndex(entry.Main.Temp, float64(entry.Main.Humidity)),
+		Humidity:      entry.Main.Humidity,
+		WindSpeed:     entry.Wind.Speed * 3.6,
+		WindDegrees:   float64(entry.Wind.Deg),
+		WindGust:      entry.Wind.Gust * 3.6,
+		Beaufort:      entry.Wind.Beaufort(),
+		Rain:          entry.Rain.ThreeHours,
+		RainIntensity: entry.Rain.RainIntensity(),
+		Clouds:        entry.Clouds.All,
+		Pop:           entry.Pop,
+		ConditionId:   conditionId,
+	}
+
+	if entry.Main.Humidity > 0 {
+		dewPoint := DewPoint(entry.Main.Temp, float64(entry.Main.Humidity))
+		block.DewPoint = &dewPoint
+	}
+
+	// Without a rider, only the wind counts
+	block.WindChill = WindChill(block.Temperature, block.WindSpeed)
+	block.ApparentTemperature = ApparentTemperature(block.Temperature, float64(block.Humidity), block.WindSpeed, 0)
+
+	return block
+}
+
+func (b ForecastBlock) localize(l locale.Locale) ForecastBlock {
+	b.Temperature = l.Temperature(b.Temperature)
+	b.WindChill = l.Temperature(b.WindChill)
+	b.HeatIndex = l.Temperature(b.HeatIndex)
+	b.ApparentTemperature = l.Temperature(b.ApparentTemperature)
+	if b.DewPoint != nil {
+		dewPoint := l.Temperature(*b.DewPoint)
+		b.DewPoint = &dewPoint
+	}
+	b.WindSpeed = l.Speed(b.WindSpeed)
+	b.WindGust = l.Speed(b.WindGust)
+	b.Rain = l.Precipitation(b.Rain)
+	return b
+}
+
+// Wind relative to the direction of travel, in km/h. A negative headwind is a
+// tailwind, a positive crosswind comes from the right.
+type WindComponents struct {
+	Headwind  float64 `json:"headwind"`
+	Crosswind float64 `json:"crosswind"`
+	// One of headwind, crosswind or tailwind, depending on which component
+	// dominates
+	Effect string `json:"effect"`
+}
+
+// Splits the wind into components relative to the heading (in degrees
+// clockwise from north).
+func NewWindComponents(heading float64, windSpeed float64, windDegrees float64) WindComponents {
+	// Angle between the direction of travel and where the wind comes from
+	angle := (windDegrees - heading) / 180 * math.Pi
+
+	components := WindComponents{
+		Headwind:  windSpeed * math.Cos(angle),
+		Crosswind: windSpeed * math.Sin(angle),
+	}
+
+	switch {
+	case math.Abs(components.Crosswind) > math.Abs(components.Headwind):
+		components.Effect = "crosswind"
+	case components.Headwind > 0:
+		components.Effect = "headwind"
+	default:
+		components.Effect = "tailwind"
+	}
+
+	return components
+}
+
+// Part of a route with a single heading
+type RouteSegment struct {
+	Start Location
+	End   Location
+	// Distance of the start along the route and length of the segment in km
+	StartDistance float64
+	Length        float64
+}
+
+// Heading from the start to the end of the segment, in degrees clockwise from
+// north
+func (s RouteSegment) Heading() float64 {
+	return math.Mod(s.Start.bearing(s.End)+360, 360)
+}
+
+func (s RouteSegment) Midpoint() Location {
+	return Location{Lon: (s.Start.Lon + s.End.Lon) / 2, Lat: (s.Start.Lat + s.End.Lat) / 2}
+}
+
+// Splits the route into segments of about the given length (in km). Each
+// segment is reduced to the straight line between its ends, which is good
+// enough for the wind.
+func (r Route) Segments(length float64) []RouteSegment {
+	var segments []RouteSegment
+
+	if len(r) < 2 {
+		return nil
+	}
+
+	current := RouteSegment{Start: r[0]}
+	for i := 1; i < len(r); i++ {
+		current.Length += r[i-1].distance(r[i])
+		current.End = r[i]
+
+		if current.Length >= length || i == len(r)-1 {
+			segments = append(segments, current)
+			current = RouteSegment{Start: r[i], StartDistance: current.StartDistance + current.Length}
+		}
+	}
+
+	return segments
+}
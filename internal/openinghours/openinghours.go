@@ -0,0 +1,599 @@
+// Package openinghours parses and evaluates the OSM opening_hours tag, see
+// https://wiki.openstreetmap.org/wiki/Key:opening_hours/specification.
+//
+// Only the common subset of the grammar is supported: "24/7", month and date
+// ranges, weekday ranges, time spans (also past midnight), the modifiers
+// "open", "off" and "closed", comments, and normal (";") as well as additional
+// (",") rules. Public and school holidays are unknown, so rules that apply
+// only on holidays are ignored. Other constructs like "sunrise", week numbers
+// or nth weekdays result in a parse error.
+package openinghours
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Time span within a day in minutes since midnight. The end may exceed 24
+// hours for spans past midnight, e.g. 22:00-02:00.
+type timeSpan struct {
+	start, end int
+}
+
+// Date within a year, a day of 0 means the whole month.
+type monthDay struct {
+	month time.Month
+	day   int
+}
+
+type dateRange struct {
+	from, to monthDay
+}
+
+func (r dateRange) contains(date time.Time) bool {
+	from := int(r.from.month)*100 + max(r.from.day, 1)
+	to := int(r.to.month)*100 + r.to.day
+	if r.to.day == 0 {
+		to = int(r.to.month)*100 + 31
+	}
+	value := int(date.Month())*100 + date.Day()
+
+	// Ranges like Nov-Feb wrap around the end of the year
+	if from <= to {
+		return value >= from && value <= to
+	}
+	return value >= from || value <= to
+}
+
+type weekdayRange struct {
+	from, to time.Weekday
+}
+
+func (r weekdayRange) contains(weekday time.Weekday) bool {
+	if r.from <= r.to {
+		return weekday >= r.from && weekday <= r.to
+	}
+	return weekday >= r.from || weekday <= r.to
+}
+
+type rule struct {
+	dates    []dateRange
+	weekdays []weekdayRange
+	// Only the (unknown) holidays were selected
+	holidaysOnly bool
+	spans        []timeSpan
+	off          bool
+	// Additional rules (separated by ",") add to the previous rules instead of
+	// replacing them
+	additional bool
+}
+
+func (r rule) matches(date time.Time) bool {
+	if r.holidaysOnly {
+		return false
+	}
+
+	if r.dates != nil && !containsFunc(r.dates, func(d dateRange) bool { return d.contains(date) }) {
+		return false
+	}
+
+	if r.weekdays != nil && !containsFunc(r.weekdays, func(w weekdayRange) bool { return w.contains(date.Weekday()) }) {
+		return false
+	}
+
+	return true
+}
+
+func containsFunc[T any](values []T, f func(T) bool) bool {
+	for _, value := range values {
+		if f(value) {
+			return true
+		}
+	}
+	return false
+}
+
+type OpeningHours struct {
+	rules []rule
+}
+
+// Returns the open time spans of the day of the given date, in minutes since
+// its midnight.
+func (o *OpeningHours) spansOn(date time.Time) []timeSpan {
+	var spans []timeSpan
+
+	for _, rule := range o.rules {
+		if !rule.matches(date) {
+			continue
+		}
+
+		if !rule.additional || rule.off {
+			spans = nil
+		}
+		if rule.off {
+			continue
+		}
+
+		if rule.spans == nil {
+			spans = append(spans, timeSpan{start: 0, end: 24 * 60})
+		} else {
+			spans = append(spans, rule.spans...)
+		}
+	}
+
+	return spans
+}
+
+type interval struct {
+	start, end time.Time
+}
+
+// Number of days that are evaluated to find the next change, e.g. for a
+// place that is only open on Sundays.
+const lookaheadDays = 8
+
+// Returns the merged open intervals from the day before t (for spans past
+// midnight) until the end of the lookahead. Times are in the location of t.
+func (o *OpeningHours) intervals(t time.Time) (intervals []interval, horizon time.Time) {
+	year, month, day := t.Date()
+
+	for offset := -1; offset <= lookaheadDays; offset++ {
+		midnight := time.Date(year, month, day+offset, 0, 0, 0, 0, t.Location())
+
+		for _, span := range o.spansOn(midnight) {
+			start := time.Date(year, month, day+offset, 0, span.start, 0, 0, t.Location())
+			end := time.Date(year, month, day+offset, 0, span.end, 0, 0, t.Location())
+
+			intervals = append(intervals, interval{start: start, end: end})
+		}
+	}
+
+	horizon = time.Date(year, month, day+lookaheadDays+1, 0, 0, 0, 0, t.Location())
+
+	return mergeIntervals(intervals), horizon
+}
+
+func mergeIntervals(intervals []interval) []interval {
+	// Insertion sort, there are only a few intervals
+	for i := 1; i < len(intervals); i++ {
+		for j := i; j > 0 && intervals[j].start.Before(intervals[j-1].start); j-- {
+			intervals[j], intervals[j-1] = intervals[j-1], intervals[j]
+		}
+	}
+
+	var merged []interval
+	for _, current := range intervals {
+		if len(merged) > 0 && !current.start.After(merged[len(merged)-1].end) {
+			if current.end.After(merged[len(merged)-1].end) {
+				merged[len(merged)-1].end = current.end
+			}
+			continue
+		}
+		merged = append(merged, current)
+	}
+
+	return merged
+}
+
+// Returns whether the place is open at t, which must be in the local time
+// zone of the place, and when this changes next. The next change is zero, if
+// it is not within the next week, e.g. for "24/7".
+func (o *OpeningHours) State(t time.Time) (open bool, nextChange time.Time) {
+	intervals, horizon := o.intervals(t)
+
+	for _, current := range intervals {
+		if t.Before(current.start) {
+			return false, current.start
+		}
+
+		if t.Before(current.end) {
+			if !current.end.Before(horizon) {
+				return true, time.Time{}
+			}
+			return true, current.end
+		}
+	}
+
+	return false, time.Time{}
+}
+
+// Parse
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenNumber
+	tokenTime
+	tokenDash
+	tokenComma
+	tokenColon
+	tokenSemicolon
+	tokenFallback
+	tokenPlus
+	tokenComment
+	tokenAlways
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value int
+}
+
+func tokenize(value string) ([]token, error) {
+	var tokens []token
+	runes := []rune(value)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.HasPrefix(string(runes[i:]), "24/7"):
+			tokens = append(tokens, token{kind: tokenAlways, text: "24/7"})
+			i += 4
+		case r == '-' || r == '–':
+			tokens = append(tokens, token{kind: tokenDash, text: "-"})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ","})
+			i++
+		case r == ':':
+			tokens = append(tokens, token{kind: tokenColon, text: ":"})
+			i++
+		case r == ';':
+			tokens = append(tokens, token{kind: tokenSemicolon, text: ";"})
+			i++
+		case r == '+':
+			tokens = append(tokens, token{kind: tokenPlus, text: "+"})
+			i++
+		case r == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			tokens = append(tokens, token{kind: tokenFallback, text: "||"})
+			i += 2
+		case r == '"':
+			end := strings.IndexRune(string(runes[i+1:]), '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			comment := string(runes[i+1:])[:end]
+			tokens = append(tokens, token{kind: tokenComment, text: comment})
+			i += len([]rune(comment)) + 2
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			hours, _ := strconv.Atoi(string(runes[start:i]))
+
+			// Times are written as HH:MM, a colon followed by a weekday or
+			// time separates selectors instead
+			if i+2 < len(runes) && runes[i] == ':' && unicode.IsDigit(runes[i+1]) && unicode.IsDigit(runes[i+2]) {
+				minutes, _ := strconv.Atoi(string(runes[i+1 : i+3]))
+				i += 3
+				tokens = append(tokens, token{kind: tokenTime, text: string(runes[start:i]), value: hours*60 + minutes})
+				continue
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), value: hours})
+		case unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[start:i])})
+		default:
+			return nil, fmt.Errorf("unsupported character %q", r)
+		}
+	}
+
+	return tokens, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"mo": time.Monday,
+	"tu": time.Tuesday,
+	"we": time.Wednesday,
+	"th": time.Thursday,
+	"fr": time.Friday,
+	"sa": time.Saturday,
+	"su": time.Sunday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January,
+	"feb": time.February,
+	"mar": time.March,
+	"apr": time.April,
+	"may": time.May,
+	"jun": time.June,
+	"jul": time.July,
+	"aug": time.August,
+	"sep": time.September,
+	"oct": time.October,
+	"nov": time.November,
+	"dec": time.December,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) peekKind(kind tokenKind) bool {
+	t, ok := p.peek()
+	return ok && t.kind == kind
+}
+
+func (p *parser) peekWeekday() bool {
+	t, ok := p.peek()
+	if !ok || t.kind != tokenWord {
+		return false
+	}
+	_, isWeekday := weekdays[strings.ToLower(t.text)]
+	return isWeekday || t.text == "PH" || t.text == "SH"
+}
+
+func (p *parser) peekMonth() bool {
+	t, ok := p.peek()
+	if !ok || t.kind != tokenWord {
+		return false
+	}
+	_, isMonth := months[strings.ToLower(t.text)]
+	return isMonth
+}
+
+// Looks ahead, whether the comma at the current position continues a time
+// list, e.g. "08:00-12:00,14:00-18:00"
+func (p *parser) commaBeforeTime() bool {
+	return p.peekKind(tokenComma) && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == tokenTime
+}
+
+func (p *parser) commaBeforeWeekday() bool {
+	if !p.peekKind(tokenComma) {
+		return false
+	}
+	p.pos++
+	isWeekday := p.peekWeekday()
+	p.pos--
+	return isWeekday
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+// Parses the value of an opening_hours tag.
+func Parse(value string) (*OpeningHours, error) {
+	tokens, err := tokenize(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty opening hours")
+	}
+
+	p := &parser{tokens: tokens}
+	hours := &OpeningHours{}
+	additional := false
+
+	for {
+		r, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		r.additional = additional
+		hours.rules = append(hours.rules, r)
+
+		t, ok := p.peek()
+		if !ok {
+			break
+		}
+
+		switch t.kind {
+		case tokenSemicolon, tokenFallback:
+			// Fallback rules are treated like normal rules, which is correct
+			// for the common "... || "by appointment"" case
+			additional = false
+		case tokenComma:
+			additional = true
+		default:
+			return nil, fmt.Errorf("unexpected %q", t.text)
+		}
+		p.pos++
+
+		// Trailing separators are common
+		if _, ok := p.peek(); !ok {
+			break
+		}
+	}
+
+	return hours, nil
+}
+
+func (p *parser) parseRule() (rule, error) {
+	var r rule
+
+	if p.peekKind(tokenAlways) {
+		p.pos++
+	}
+
+	if p.peekMonth() {
+		dates, err := p.parseDates()
+		if err != nil {
+			return rule{}, err
+		}
+		r.dates = dates
+		if p.peekKind(tokenColon) {
+			p.pos++
+		}
+	}
+
+	if p.peekWeekday() {
+		weekdayRanges, holidays, err := p.parseWeekdays()
+		if err != nil {
+			return rule{}, err
+		}
+		r.weekdays = weekdayRanges
+		r.holidaysOnly = holidays && weekdayRanges == nil
+		if p.peekKind(tokenColon) {
+			p.pos++
+		}
+	}
+
+	if p.peekKind(tokenTime) {
+		spans, err := p.parseTimes()
+		if err != nil {
+			return rule{}, err
+		}
+		r.spans = spans
+	}
+
+	if t, ok := p.peek(); ok && t.kind == tokenWord {
+		switch strings.ToLower(t.text) {
+		case "off", "closed":
+			r.off = true
+		case "open":
+		default:
+			return rule{}, fmt.Errorf("unsupported %q", t.text)
+		}
+		p.pos++
+	}
+
+	if p.peekKind(tokenComment) {
+		p.pos++
+	}
+
+	return r, nil
+}
+
+func (p *parser) parseMonthDay() (monthDay, error) {
+	t := p.next()
+	month, ok := months[strings.ToLower(t.text)]
+	if !ok {
+		return monthDay{}, fmt.Errorf("expected month, got %q", t.text)
+	}
+
+	date := monthDay{month: month}
+	if p.peekKind(tokenNumber) {
+		date.day = p.next().value
+		if date.day < 1 || date.day > 31 {
+			return monthDay{}, fmt.Errorf("invalid day %d", date.day)
+		}
+	}
+
+	return date, nil
+}
+
+func (p *parser) parseDates() ([]dateRange, error) {
+	var ranges []dateRange
+
+	for {
+		from, err := p.parseMonthDay()
+		if err != nil {
+			return nil, err
+		}
+		to := from
+
+		if p.peekKind(tokenDash) {
+			p.pos++
+			switch {
+			case p.peekMonth():
+				to, err = p.parseMonthDay()
+				if err != nil {
+					return nil, err
+				}
+			case p.peekKind(tokenNumber) && from.day != 0:
+				// Day range within a month, e.g. "Dec 24-26"
+				to = monthDay{month: from.month, day: p.next().value}
+			default:
+				return nil, fmt.Errorf("invalid date range")
+			}
+		}
+
+		ranges = append(ranges, dateRange{from: from, to: to})
+
+		if !p.peekKind(tokenComma) || p.pos+1 >= len(p.tokens) {
+			return ranges, nil
+		}
+		p.pos++
+		if !p.peekMonth() {
+			p.pos--
+			return ranges, nil
+		}
+	}
+}
+
+func (p *parser) parseWeekdays() (ranges []weekdayRange, holidays bool, err error) {
+	for {
+		t := p.next()
+
+		if t.text == "PH" || t.text == "SH" {
+			holidays = true
+		} else {
+			from := weekdays[strings.ToLower(t.text)]
+			to := from
+
+			if p.peekKind(tokenDash) {
+				p.pos++
+				if !p.peekWeekday() {
+					return nil, false, fmt.Errorf("invalid weekday range")
+				}
+				to = weekdays[strings.ToLower(p.next().text)]
+			}
+
+			ranges = append(ranges, weekdayRange{from: from, to: to})
+		}
+
+		if !p.commaBeforeWeekday() {
+			return ranges, holidays, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseTimes() ([]timeSpan, error) {
+	var spans []timeSpan
+
+	for {
+		start := p.next()
+		if !p.peekKind(tokenDash) {
+			return nil, fmt.Errorf("expected time span after %s", start.text)
+		}
+		p.pos++
+
+		if !p.peekKind(tokenTime) {
+			return nil, fmt.Errorf("expected end of time span after %s", start.text)
+		}
+		end := p.next()
+
+		if p.peekKind(tokenPlus) {
+			return nil, fmt.Errorf("open end is not supported")
+		}
+
+		span := timeSpan{start: start.value, end: end.value}
+		if span.end <= span.start {
+			span.end += 24 * 60
+		}
+		if span.start > 24*60 || span.end > 48*60 {
+			return nil, fmt.Errorf("invalid time span %s-%s", start.text, end.text)
+		}
+		spans = append(spans, span)
+
+		if !p.commaBeforeTime() {
+			return spans, nil
+		}
+		p.pos++
+	}
+}
@@ -0,0 +1,74 @@
+package openinghours
+
+import (
+	"testing"
+	"time"
+)
+
+func TestState(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2024-07-01 is a Monday
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, time.July, day, hour, minute, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		value      string
+		now        time.Time
+		open       bool
+		nextChange time.Time
+	}{
+		{"24/7", at(1, 3, 0), true, time.Time{}},
+		{"Mo-Fr 08:00-18:00", at(1, 9, 0), true, at(1, 18, 0)},
+		{"Mo-Fr 08:00-18:00", at(1, 7, 0), false, at(1, 8, 0)},
+		{"Mo-Fr 08:00-18:00", at(5, 19, 0), false, at(8, 8, 0)},
+		{"Mo-Fr 08:00-12:00,14:00-18:00", at(2, 13, 0), false, at(2, 14, 0)},
+		{"Mo-Fr 08:00-18:00; We off", at(3, 9, 0), false, at(4, 8, 0)},
+		{"Mo-Fr 08:00-18:00; We 10:00-12:00", at(3, 9, 0), false, at(3, 10, 0)},
+		{"Mo,We,Fr 10:00-12:00", at(2, 11, 0), false, at(3, 10, 0)},
+		{"Mo-Sa 07:00-12:00, Su 08:00-11:00", at(7, 9, 0), true, at(7, 11, 0)},
+		{"Fr-Sa 22:00-02:00", at(6, 1, 0), true, at(6, 2, 0)},
+		{"Fr-Sa 22:00-02:00", at(7, 1, 0), true, at(7, 2, 0)},
+		{"Su 10:00-12:00", at(1, 9, 0), false, at(7, 10, 0)},
+		{"Sa", at(6, 15, 0), true, at(7, 0, 0)},
+		{"Apr-Oct: 08:00-20:00", at(1, 21, 0), false, at(2, 8, 0)},
+		{"Nov-Mar 10:00-16:00", at(1, 12, 0), false, time.Time{}},
+		{"10:00-16:00; Jul 02-Jul 03 off", at(2, 12, 0), false, at(4, 10, 0)},
+		{"Mo-Fr 09:00-17:00; PH off", at(1, 12, 0), true, at(1, 17, 0)},
+		{"Mo-Fr 09:00-17:00 \"by appointment\"", at(1, 12, 0), true, at(1, 17, 0)},
+		{"08:00-18:00;", at(1, 12, 0), true, at(1, 18, 0)},
+	}
+
+	for _, test := range tests {
+		hours, err := Parse(test.value)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", test.value, err)
+			continue
+		}
+
+		open, nextChange := hours.State(test.now)
+		if open != test.open || !nextChange.Equal(test.nextChange) {
+			t.Errorf("%q at %v: got open %v, next change %v, want %v, %v", test.value, test.now, open, nextChange, test.open, test.nextChange)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"sunrise-sunset",
+		"Mo-Fr 08:00+",
+		"Mo[1] 10:00-12:00",
+		"week 1-53 Mo 10:00-12:00",
+		"Mo-Fr 08:00",
+		"\"unterminated",
+	} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("Parse(%q) should return an error", value)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+// Package osmpbf reads OpenStreetMap data in the PBF format, see
+// https://wiki.openstreetmap.org/wiki/PBF_Format. Only what is needed to
+// extract POIs is decoded: ids, coordinates, tags, way nodes and relation
+// members. Metadata like versions and timestamps is skipped.
+package osmpbf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/leomfn/rueckenwind/internal/protobuf"
+)
+
+type Node struct {
+	ID   int64
+	Lon  float64
+	Lat  float64
+	Tags map[string]string
+}
+
+type Way struct {
+	ID   int64
+	Refs []int64
+	Tags map[string]string
+}
+
+type MemberType int
+
+const (
+	NodeMember MemberType = iota
+	WayMember
+	RelationMember
+)
+
+type Member struct {
+	Type MemberType
+	Ref  int64
+	Role string
+}
+
+type Relation struct {
+	ID      int64
+	Members []Member
+	Tags    map[string]string
+}
+
+// Callbacks for the decoded elements. Elements without a callback are not
+// decoded at all, which makes passes over large files that only need some
+// element types considerably faster.
+type Handler struct {
+	Node     func(Node)
+	Way      func(Way)
+	Relation func(Relation)
+}
+
+// Upper limits from the format specification
+const (
+	maxBlobHeaderSize = 64 * 1024
+	maxBlobSize       = 32 * 1024 * 1024
+)
+
+// Reads all blocks of the file and calls the handler for each element in file
+// order.
+func Scan(r io.Reader, handler Handler) error {
+	var lengthBuffer [4]byte
+
+	for {
+		if _, err := io.ReadFull(r, lengthBuffer[:]); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		headerLength := binary.BigEndian.Uint32(lengthBuffer[:])
+		if headerLength > maxBlobHeaderSize {
+			return fmt.Errorf("blob header too large: %d bytes", headerLength)
+		}
+
+		headerData := make([]byte, headerLength)
+		if _, err := io.ReadFull(r, headerData); err != nil {
+			return err
+		}
+
+		blobType, blobSize, err := decodeBlobHeader(headerData)
+		if err != nil {
+			return err
+		}
+		if blobSize > maxBlobSize {
+			return fmt.Errorf("blob too large: %d bytes", blobSize)
+		}
+
+		blobData := make([]byte, blobSize)
+		if _, err := io.ReadFull(r, blobData); err != nil {
+			return err
+		}
+
+		switch blobType {
+		case "OSMHeader":
+			// Only the feature list would be of interest, all features we
+			// read are part of every file
+			continue
+		case "OSMData":
+			data, err := decodeBlob(blobData)
+			if err != nil {
+				return err
+			}
+			if err := decodePrimitiveBlock(data, handler); err != nil {
+				return err
+			}
+		default:
+			// Unknown blob types must be skipped according to the spec
+		}
+	}
+}
+
+func decodeBlobHeader(data []byte) (blobType string, blobSize int, err error) {
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			blobType = string(m.Bytes())
+		case 3:
+			blobSize = int(m.Varint())
+		}
+	}
+	return blobType, blobSize, m.Err()
+}
+
+func decodeBlob(data []byte) ([]byte, error) {
+	var (
+		raw      []byte
+		zlibData []byte
+		rawSize  int
+	)
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			raw = m.Bytes()
+		case 2:
+			rawSize = int(m.Varint())
+		case 3:
+			zlibData = m.Bytes()
+		case 4, 5, 6, 7:
+			return nil, errors.New("unsupported blob compression, only zlib is supported")
+		}
+	}
+	if m.Err() != nil {
+		return nil, m.Err()
+	}
+
+	if raw != nil {
+		return raw, nil
+	}
+
+	if rawSize <= 0 || rawSize > maxBlobSize {
+		return nil, fmt.Errorf("invalid raw size of blob: %d bytes", rawSize)
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(zlibData))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// A corrupt blob must not inflate beyond its declared size
+	out := bytes.NewBuffer(make([]byte, 0, rawSize))
+	if _, err := io.Copy(out, io.LimitReader(reader, int64(rawSize)+1)); err != nil {
+		return nil, err
+	}
+	if out.Len() > rawSize {
+		return nil, fmt.Errorf("blob larger than its raw size of %d bytes", rawSize)
+	}
+
+	return out.Bytes(), nil
+}
+
+// Shared state of a primitive block, coordinates are stored as integers that
+// are scaled by the granularity.
+type block struct {
+	strings     []string
+	granularity int64
+	latOffset   int64
+	lonOffset   int64
+}
+
+func (b *block) lat(value int64) float64 {
+	return 1e-9 * float64(b.latOffset+b.granularity*value)
+}
+
+func (b *block) lon(value int64) float64 {
+	return 1e-9 * float64(b.lonOffset+b.granularity*value)
+}
+
+func (b *block) string(index uint64) string {
+	if index >= uint64(len(b.strings)) {
+		return ""
+	}
+	return b.strings[index]
+}
+
+func (b *block) tags(keys []uint64, values []uint64) map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	tags := make(map[string]string, len(keys))
+	for i, key := range keys {
+		if i < len(values) {
+			tags[b.string(key)] = b.string(values[i])
+		}
+	}
+	return tags
+}
+
+func decodePrimitiveBlock(data []byte, handler Handler) error {
+	b := block{granularity: 100}
+	var groups [][]byte
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			table := protobuf.NewMessage(m.Bytes())
+			for table.Next() {
+				if table.Field() == 1 {
+					b.strings = append(b.strings, string(table.Bytes()))
+				}
+			}
+			if table.Err() != nil {
+				return table.Err()
+			}
+		case 2:
+			groups = append(groups, m.Bytes())
+		case 17:
+			b.granularity = int64(m.Varint())
+		case 19:
+			b.latOffset = int64(m.Varint())
+		case 20:
+			b.lonOffset = int64(m.Varint())
+		}
+	}
+	if m.Err() != nil {
+		return m.Err()
+	}
+
+	// The string table and the granularity may follow the groups, so groups
+	// are decoded once the whole block was read
+	for _, group := range groups {
+		if err := b.decodeGroup(group, handler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *block) decodeGroup(data []byte, handler Handler) error {
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		var err error
+
+		switch {
+		case m.Field() == 1 && handler.Node != nil:
+			err = b.decodeNode(m.Bytes(), handler.Node)
+		case m.Field() == 2 && handler.Node != nil:
+			err = b.decodeDenseNodes(m.Bytes(), handler.Node)
+		case m.Field() == 3 && handler.Way != nil:
+			err = b.decodeWay(m.Bytes(), handler.Way)
+		case m.Field() == 4 && handler.Relation != nil:
+			err = b.decodeRelation(m.Bytes(), handler.Relation)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return m.Err()
+}
+
+func (b *block) decodeNode(data []byte, callback func(Node)) error {
+	var (
+		node       Node
+		keys, vals []uint64
+		lat, lon   int64
+	)
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			node.ID = protobuf.Zigzag(m.Varint())
+		case 2:
+			keys = m.PackedVarints(keys)
+		case 3:
+			vals = m.PackedVarints(vals)
+		case 8:
+			lat = protobuf.Zigzag(m.Varint())
+		case 9:
+			lon = protobuf.Zigzag(m.Varint())
+		}
+	}
+	if m.Err() != nil {
+		return m.Err()
+	}
+
+	node.Lat = b.lat(lat)
+	node.Lon = b.lon(lon)
+	node.Tags = b.tags(keys, vals)
+	callback(node)
+
+	return nil
+}
+
+func (b *block) decodeDenseNodes(data []byte, callback func(Node)) error {
+	var ids, lats, lons, keysVals []uint64
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			ids = m.PackedVarints(ids)
+		case 8:
+			lats = m.PackedVarints(lats)
+		case 9:
+			lons = m.PackedVarints(lons)
+		case 10:
+			keysVals = m.PackedVarints(keysVals)
+		}
+	}
+	if m.Err() != nil {
+		return m.Err()
+	}
+
+	if len(lats) != len(ids) || len(lons) != len(ids) {
+		return errors.New("dense nodes with inconsistent lengths")
+	}
+
+	var id, lat, lon int64
+	tagIndex := 0
+
+	for i := range ids {
+		// Ids and coordinates are delta encoded
+		id += protobuf.Zigzag(ids[i])
+		lat += protobuf.Zigzag(lats[i])
+		lon += protobuf.Zigzag(lons[i])
+
+		node := Node{ID: id, Lat: b.lat(lat), Lon: b.lon(lon)}
+
+		// Tags of all nodes are stored as key, value, ..., 0 for each node
+		for tagIndex < len(keysVals) {
+			key := keysVals[tagIndex]
+			tagIndex++
+			if key == 0 {
+				break
+			}
+			if tagIndex >= len(keysVals) {
+				return errors.New("dense node tag without value")
+			}
+			if node.Tags == nil {
+				node.Tags = map[string]string{}
+			}
+			node.Tags[b.string(key)] = b.string(keysVals[tagIndex])
+			tagIndex++
+		}
+
+		callback(node)
+	}
+
+	return nil
+}
+
+func (b *block) decodeWay(data []byte, callback func(Way)) error {
+	var (
+		way        Way
+		keys, vals []uint64
+		refs       []uint64
+	)
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			way.ID = int64(m.Varint())
+		case 2:
+			keys = m.PackedVarints(keys)
+		case 3:
+			vals = m.PackedVarints(vals)
+		case 8:
+			refs = m.PackedVarints(refs)
+		}
+	}
+	if m.Err() != nil {
+		return m.Err()
+	}
+
+	way.Tags = b.tags(keys, vals)
+	way.Refs = make([]int64, len(refs))
+
+	var ref int64
+	for i, delta := range refs {
+		ref += protobuf.Zigzag(delta)
+		way.Refs[i] = ref
+	}
+
+	callback(way)
+
+	return nil
+}
+
+func (b *block) decodeRelation(data []byte, callback func(Relation)) error {
+	var (
+		relation          Relation
+		keys, vals, roles []uint64
+		memberIds, types  []uint64
+	)
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			relation.ID = int64(m.Varint())
+		case 2:
+			keys = m.PackedVarints(keys)
+		case 3:
+			vals = m.PackedVarints(vals)
+		case 8:
+			roles = m.PackedVarints(roles)
+		case 9:
+			memberIds = m.PackedVarints(memberIds)
+		case 10:
+			types = m.PackedVarints(types)
+		}
+	}
+	if m.Err() != nil {
+		return m.Err()
+	}
+
+	if len(types) != len(memberIds) {
+		return errors.New("relation with inconsistent member lengths")
+	}
+
+	relation.Tags = b.tags(keys, vals)
+	relation.Members = make([]Member, len(memberIds))
+
+	var ref int64
+	for i, delta := range memberIds {
+		ref += protobuf.Zigzag(delta)
+		relation.Members[i] = Member{Type: MemberType(types[i]), Ref: ref}
+		if i < len(roles) {
+			relation.Members[i].Role = b.string(roles[i])
+		}
+	}
+
+	callback(relation)
+
+	return nil
+}
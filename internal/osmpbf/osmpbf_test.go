@@ -0,0 +1,224 @@
+package osmpbf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/leomfn/rueckenwind/internal/protobuf"
+)
+
+// Minimal protobuf writer to build test files
+type protoWriter struct {
+	bytes.Buffer
+}
+
+func (w *protoWriter) key(field int, wireType int) {
+	w.Write(binary.AppendUvarint(nil, uint64(field<<3|wireType)))
+}
+
+func (w *protoWriter) varint(field int, value uint64) {
+	w.key(field, protobuf.WireVarint)
+	w.Write(binary.AppendUvarint(nil, value))
+}
+
+func (w *protoWriter) bytesField(field int, value []byte) {
+	w.key(field, protobuf.WireBytes)
+	w.Write(binary.AppendUvarint(nil, uint64(len(value))))
+	w.Write(value)
+}
+
+func (w *protoWriter) packed(field int, values ...uint64) {
+	var data []byte
+	for _, value := range values {
+		data = binary.AppendUvarint(data, value)
+	}
+	w.bytesField(field, data)
+}
+
+func encodeZigzag(value int64) uint64 {
+	return uint64((value << 1) ^ (value >> 63))
+}
+
+// Zigzag and delta encodes the values
+func deltas(values ...int64) []uint64 {
+	var encoded []uint64
+	var previous int64
+	for _, value := range values {
+		encoded = append(encoded, encodeZigzag(value-previous))
+		previous = value
+	}
+	return encoded
+}
+
+func writeBlob(file *bytes.Buffer, blobType string, data []byte, compress bool) {
+	var blob protoWriter
+	if compress {
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		writer.Write(data)
+		writer.Close()
+		blob.varint(2, uint64(len(data)))
+		blob.bytesField(3, compressed.Bytes())
+	} else {
+		blob.bytesField(1, data)
+	}
+
+	var header protoWriter
+	header.bytesField(1, []byte(blobType))
+	header.varint(3, uint64(blob.Len()))
+
+	file.Write(binary.BigEndian.AppendUint32(nil, uint32(header.Len())))
+	file.Write(header.Bytes())
+	file.Write(blob.Bytes())
+}
+
+func testFile() []byte {
+	var file bytes.Buffer
+
+	var header protoWriter
+	header.bytesField(4, []byte("OsmSchema-V0.6"))
+	writeBlob(&file, "OSMHeader", header.Bytes(), false)
+
+	// String table: 0 is reserved for the delimiter of dense node tags
+	var stringTable protoWriter
+	for _, s := range []string{"", "amenity", "cafe", "name", "Kaffeebar", "tourism", "camp_site", "outer"} {
+		stringTable.bytesField(1, []byte(s))
+	}
+
+	var dense protoWriter
+	dense.packed(1, deltas(1, 2, 3)...)
+	// Coordinates in units of the granularity of 100 nanodegrees
+	dense.packed(8, deltas(525000000, 525100000, 525200000)...)
+	dense.packed(9, deltas(134000000, 134100000, 134200000)...)
+	dense.packed(10, 1, 2, 3, 4, 0, 0, 0)
+
+	var way protoWriter
+	way.varint(1, 10)
+	way.packed(2, 5)
+	way.packed(3, 6)
+	way.packed(8, deltas(1, 2, 3, 1)...)
+
+	var relation protoWriter
+	relation.varint(1, 20)
+	relation.packed(2, 5)
+	relation.packed(3, 6)
+	relation.packed(8, 7, 0)
+	relation.packed(9, deltas(10, 3)...)
+	relation.packed(10, uint64(WayMember), uint64(NodeMember))
+
+	var nodeGroup, wayGroup, relationGroup protoWriter
+	nodeGroup.bytesField(2, dense.Bytes())
+	wayGroup.bytesField(3, way.Bytes())
+	relationGroup.bytesField(4, relation.Bytes())
+
+	var primitiveBlock protoWriter
+	primitiveBlock.bytesField(1, stringTable.Bytes())
+	primitiveBlock.bytesField(2, nodeGroup.Bytes())
+	primitiveBlock.bytesField(2, wayGroup.Bytes())
+	primitiveBlock.bytesField(2, relationGroup.Bytes())
+	writeBlob(&file, "OSMData", primitiveBlock.Bytes(), true)
+
+	return file.Bytes()
+}
+
+func TestScan(t *testing.T) {
+	var (
+		nodes     []Node
+		ways      []Way
+		relations []Relation
+	)
+
+	err := Scan(bytes.NewReader(testFile()), Handler{
+		Node:     func(node Node) { nodes = append(nodes, node) },
+		Way:      func(way Way) { ways = append(ways, way) },
+		Relation: func(relation Relation) { relations = append(relations, relation) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("dense nodes", func(t *testing.T) {
+		if len(nodes) != 3 {
+			t.Fatalf("expected 3 nodes, but got %d", len(nodes))
+		}
+
+		node := nodes[1]
+		if node.ID != 2 || math.Abs(node.Lat-52.51) > 1e-9 || math.Abs(node.Lon-13.41) > 1e-9 {
+			t.Fatalf("unexpected node %+v", node)
+		}
+
+		expectedTags := map[string]string{"amenity": "cafe", "name": "Kaffeebar"}
+		if !reflect.DeepEqual(nodes[0].Tags, expectedTags) {
+			t.Fatalf("expected tags %v, but got %v", expectedTags, nodes[0].Tags)
+		}
+		if nodes[1].Tags != nil || nodes[2].Tags != nil {
+			t.Fatalf("expected nodes without tags, but got %v and %v", nodes[1].Tags, nodes[2].Tags)
+		}
+	})
+
+	t.Run("ways", func(t *testing.T) {
+		if len(ways) != 1 {
+			t.Fatalf("expected 1 way, but got %d", len(ways))
+		}
+
+		if !reflect.DeepEqual(ways[0].Refs, []int64{1, 2, 3, 1}) {
+			t.Fatalf("unexpected refs %v", ways[0].Refs)
+		}
+		if ways[0].Tags["tourism"] != "camp_site" {
+			t.Fatalf("unexpected tags %v", ways[0].Tags)
+		}
+	})
+
+	t.Run("relations", func(t *testing.T) {
+		if len(relations) != 1 {
+			t.Fatalf("expected 1 relation, but got %d", len(relations))
+		}
+
+		expectedMembers := []Member{
+			{Type: WayMember, Ref: 10, Role: "outer"},
+			{Type: NodeMember, Ref: 3, Role: ""},
+		}
+		if !reflect.DeepEqual(relations[0].Members, expectedMembers) {
+			t.Fatalf("expected members %v, but got %v", expectedMembers, relations[0].Members)
+		}
+	})
+
+	t.Run("skipped element types", func(t *testing.T) {
+		var count int
+		err := Scan(bytes.NewReader(testFile()), Handler{
+			Way: func(way Way) { count++ },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatalf("expected 1 way, but got %d", count)
+		}
+	})
+
+	t.Run("blob larger than its raw size", func(t *testing.T) {
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		writer.Write(make([]byte, 1000))
+		writer.Close()
+
+		var blob protoWriter
+		blob.varint(2, 10)
+		blob.bytesField(3, compressed.Bytes())
+
+		if _, err := decodeBlob(blob.Bytes()); err == nil {
+			t.Fatal("expected error for blob exceeding its raw size")
+		}
+	})
+
+	t.Run("truncated file", func(t *testing.T) {
+		data := testFile()
+		if err := Scan(bytes.NewReader(data[:len(data)-10]), Handler{}); err == nil {
+			t.Fatal("expected error for truncated file")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+// Package protobuf reads the protobuf wire format without generated code.
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Minimal protobuf wire format reader. Fields are iterated with Next, the
+// value of the current field is read with one of the accessors according to
+// its type in the schema.
+type Message struct {
+	data     []byte
+	field    int
+	wireType int
+	value    []byte
+	number   uint64
+	err      error
+}
+
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+var ErrTruncated = errors.New("truncated protobuf message")
+
+func NewMessage(data []byte) *Message {
+	return &Message{data: data}
+}
+
+// Advances to the next field, returns false at the end of the message or on
+// an error.
+func (m *Message) Next() bool {
+	if m.err != nil || len(m.data) == 0 {
+		return false
+	}
+
+	key, n := binary.Uvarint(m.data)
+	if n <= 0 {
+		m.err = ErrTruncated
+		return false
+	}
+	m.data = m.data[n:]
+
+	m.field = int(key >> 3)
+	m.wireType = int(key & 7)
+	m.value = nil
+	m.number = 0
+
+	switch m.wireType {
+	case WireVarint:
+		m.number, n = binary.Uvarint(m.data)
+		if n <= 0 {
+			m.err = ErrTruncated
+			return false
+		}
+		m.data = m.data[n:]
+	case WireFixed64:
+		if len(m.data) < 8 {
+			m.err = ErrTruncated
+			return false
+		}
+		m.number = binary.LittleEndian.Uint64(m.data)
+		m.data = m.data[8:]
+	case WireBytes:
+		length, n := binary.Uvarint(m.data)
+		if n <= 0 || uint64(len(m.data)-n) < length {
+			m.err = ErrTruncated
+			return false
+		}
+		m.value = m.data[n : n+int(length)]
+		m.data = m.data[n+int(length):]
+	case WireFixed32:
+		if len(m.data) < 4 {
+			m.err = ErrTruncated
+			return false
+		}
+		m.number = uint64(binary.LittleEndian.Uint32(m.data))
+		m.data = m.data[4:]
+	default:
+		m.err = fmt.Errorf("unsupported protobuf wire type %d", m.wireType)
+		return false
+	}
+
+	return true
+}
+
+// Number of the current field
+func (m *Message) Field() int {
+	return m.field
+}
+
+func (m *Message) Err() error {
+	return m.err
+}
+
+func (m *Message) Varint() uint64 {
+	return m.number
+}
+
+func (m *Message) Float() float32 {
+	return math.Float32frombits(uint32(m.number))
+}
+
+func (m *Message) Bytes() []byte {
+	return m.value
+}
+
+// Appends the values of a repeated varint field, which may be packed or not.
+func (m *Message) PackedVarints(values []uint64) []uint64 {
+	if m.wireType == WireVarint {
+		return append(values, m.number)
+	}
+
+	data := m.value
+	for len(data) > 0 {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			m.err = ErrTruncated
+			return values
+		}
+		values = append(values, value)
+		data = data[n:]
+	}
+
+	return values
+}
+
+// Decodes a zigzag encoded sint64
+func Zigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
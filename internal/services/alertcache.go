@@ -0,0 +1,36 @@
+package services
+
+import (
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+type AlertCache interface {
+	AlertService
+	Cache
+}
+
+// In-memory cache of official alerts
+//
+// Alerts are cached by grid cell like forecasts, see gridCache. Alerts are
+// issued and lifted at any time, so entries only live for a few minutes.
+type alertCache struct {
+	*gridCache[[]models.Alert]
+	next AlertService
+}
+
+func NewAlertCache(next AlertService, resolution float64) AlertCache {
+	const ttl = 5 * time.Minute
+
+	return &alertCache{
+		gridCache: newGridCache[[]models.Alert](resolution, func(now time.Time) time.Time {
+			return now.Add(ttl)
+		}),
+		next: next,
+	}
+}
+
+func (c *alertCache) GetAlerts(lon float64, lat float64) ([]models.Alert, error) {
+	return c.get(lon, lat, c.next.GetAlerts)
+}
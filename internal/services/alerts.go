@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// Official weather warnings
+type AlertService interface {
+	GetAlerts(lon float64, lat float64) ([]models.Alert, error)
+}
+
+var alertProviders = map[string]func() AlertService{
+	"brightsky": NewBrightSkyAlertService,
+}
+
+// Returns the names of all available alert providers in alphabetical order.
+func AlertProviders() []string {
+	return slices.Sorted(maps.Keys(alertProviders))
+}
+
+// Creates the alert service registered under the given provider name.
+func NewAlertService(provider string) (AlertService, error) {
+	factory, ok := alertProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown alert provider %q, available providers: %s",
+			provider,
+			strings.Join(AlertProviders(), ", "))
+	}
+
+	return factory(), nil
+}
+
+// Bright Sky
+//
+// Warnings of the Deutscher Wetterdienst (DWD) for the municipality of the
+// location, see https://brightsky.dev/docs/#/operations/getAlerts. Only
+// covers Germany.
+type brightSkyAlertService struct {
+	alertsUrl string
+}
+
+func NewBrightSkyAlertService() AlertService {
+	return &brightSkyAlertService{
+		alertsUrl: "https://api.brightsky.dev/alerts",
+	}
+}
+
+type brightSkyAlertsResponse struct {
+	Alerts []struct {
+		Onset         time.Time  `json:"onset"`
+		Expires       *time.Time `json:"expires"`
+		Severity      string     `json:"severity"`
+		HeadlineEn    string     `json:"headline_en"`
+		DescriptionEn string     `json:"description_en"`
+	} `json:"alerts"`
+}
+
+func (s *brightSkyAlertService) GetAlerts(lon float64, lat float64) ([]models.Alert, error) {
+	query := fmt.Sprintf("?lat=%f&lon=%f", lat, lon)
+
+	var response brightSkyAlertsResponse
+	if err := getJSON(s.alertsUrl+query, "", &response); err != nil {
+		log.Println("Error when fetching alerts from bright sky:", err)
+		return nil, err
+	}
+
+	var alerts []models.Alert
+	for _, alert := range response.Alerts {
+		officialAlert := models.Alert{
+			Type:        "official",
+			Severity:    alert.Severity,
+			Start:       alert.Onset,
+			Headline:    alert.HeadlineEn,
+			Description: alert.DescriptionEn,
+			Source:      "brightsky",
+		}
+		if alert.Expires != nil {
+			officialAlert.End = *alert.Expires
+		}
+
+		alerts = append(alerts, officialAlert)
+	}
+
+	return alerts, nil
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// Bright Sky
+//
+// JSON API for the open data of the Deutscher Wetterdienst (DWD), see
+// https://brightsky.dev/docs/. Only covers Germany and its neighbouring areas.
+type brightSkyService struct {
+	weatherUrl       string
+	forecastHours    int64
+	forecastInterval int // in hours
+}
+
+func NewBrightSkyService(forecastHours int64) WeatherService {
+	return &brightSkyService{
+		weatherUrl:       "https://api.brightsky.dev/weather",
+		forecastHours:    forecastHours,
+		forecastInterval: 3,
+	}
+}
+
+// Values may be null, if the DWD does not provide them for a station. Units
+// are the Bright Sky defaults ("dwd"), e.g. wind speed in km/h.
+type brightSkyResponse struct {
+	Weather []struct {
+		Timestamp                time.Time `json:"timestamp"`
+		Temperature              *float64  `json:"temperature"`
+		RelativeHumidity         *float64  `json:"relative_humidity"`
+		Precipitation            *float64  `json:"precipitation"`
+		PrecipitationProbability *float64  `json:"precipitation_probability"`
+		CloudCover               *float64  `json:"cloud_cover"`
+		WindSpeed                *float64  `json:"wind_speed"`
+		WindDirection            *float64  `json:"wind_direction"`
+		WindGustSpeed            *float64  `json:"wind_gust_speed"`
+		Condition                *string   `json:"condition"`
+	} `json:"weather"`
+}
+
+// Maps the Bright Sky conditions to OpenWeatherMap condition ids.
+func brightSkyCondition(condition *string) int64 {
+	if condition == nil {
+		return 0
+	}
+
+	switch *condition {
+	case "dry":
+		return 800
+	case "fog":
+		return 741
+	case "rain":
+		return 500
+	case "sleet":
+		return 611
+	case "snow":
+		return 600
+	case "hail":
+		// OpenWeatherMap has no current id for hail outside of thunderstorms,
+		// sleet is the closest frozen precipitation
+		return 611
+	case "thunderstorm":
+		return 211
+	default:
+		return 0
+	}
+}
+
+// Dereferences optional numeric values, missing values are zero.
+func valueOrZero(value *float64) float64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+func (s *brightSkyService) GetWeatherForecast(lon float64, lat float64) (models.WeatherSummary, error) {
+	now := time.Now().UTC().Truncate(time.Hour)
+
+	query := url.Values{}
+	query.Set("lat", fmt.Sprintf("%f", lat))
+	query.Set("lon", fmt.Sprintf("%f", lon))
+	query.Set("date", now.Format(time.RFC3339))
+	query.Set("last_date", now.Add(time.Duration(s.forecastHours)*time.Hour).Format(time.RFC3339))
+
+	var response brightSkyResponse
+	if err := getJSON(s.weatherUrl+"?"+query.Encode(), "", &response); err != nil {
+		log.Println("Error when fetching weather from bright sky:", err)
+		return models.WeatherSummary{}, err
+	}
+
+	hours := make([]hourlyForecast, len(response.Weather))
+	for i, record := range response.Weather {
+		hours[i] = hourlyForecast{
+			timestamp:     record.Timestamp.Unix(),
+			temp:          valueOrZero(record.Temperature),
+			humidity:      valueOrZero(record.RelativeHumidity),
+			windSpeed:     valueOrZero(record.WindSpeed) / 3.6,
+			windDeg:       valueOrZero(record.WindDirection),
+			windGust:      valueOrZero(record.WindGustSpeed) / 3.6,
+			precipitation: valueOrZero(record.Precipitation),
+			pop:           valueOrZero(record.PrecipitationProbability) / 100,
+			clouds:        valueOrZero(record.CloudCover),
+			condition:     brightSkyCondition(record.Condition),
+		}
+	}
+
+	weatherForecast := models.WeatherForecast{
+		List: aggregateHourlyForecast(hours, now, s.forecastInterval),
+		City: models.City{
+			Coord: models.Location{Lon: models.Coordinate(lon), Lat: models.Coordinate(lat)},
+		},
+	}
+	weatherForecast.Count = int64(len(weatherForecast.List))
+
+	return newWeatherSummary(weatherForecast, "brightsky")
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// POI categories
+//
+// Categories are defined in a JSON file, by default the embedded
+// categories.json. Each category has a list of filters, of which at least one
+// must match completely, and a list of exclusions, of which none may match.
+// Filters are written as "key=value", "key!=value" or just "key" for any value,
+// e.g.
+//
+//	{
+//		"name": "water",
+//		"icon": "water",
+//		"filters": [["amenity=drinking_water"], ["drinking_water=yes"]],
+//		"exclude": ["access=private"],
+//		"tags": ["seasonal"]
+//	}
+//
+// The tags are passed on to the client for every site of the category. With
+// "entrances": true, nodes of ways tagged with entrance=* are requested as
+// well, so that e.g. camp sites can be entered at their gate.
+
+//go:embed categories.json
+var defaultPoiCategories []byte
+
+var ErrUnknownCategory = errors.New("unknown category")
+
+// Overpass tag filter, e.g. ["tourism"="camp_site"] or ["access"!="private"]
+// if negated. Without a value, the filter checks if the tag exists.
+type tagFilter struct {
+	key    string
+	value  string
+	negate bool
+}
+
+func parseTagFilter(filter string) (tagFilter, error) {
+	var f tagFilter
+
+	if key, value, ok := strings.Cut(filter, "!="); ok {
+		f = tagFilter{key: key, value: value, negate: true}
+	} else if key, value, ok := strings.Cut(filter, "="); ok {
+		f = tagFilter{key: key, value: value}
+	} else {
+		f = tagFilter{key: filter}
+	}
+
+	f.key = strings.TrimSpace(f.key)
+	f.value = strings.TrimSpace(f.value)
+
+	if f.key == "" {
+		return tagFilter{}, fmt.Errorf("invalid tag filter %q", filter)
+	}
+
+	return f, nil
+}
+
+func (f tagFilter) String() string {
+	key := strconv.Quote(f.key)
+
+	switch {
+	case f.value == "" && f.negate:
+		return fmt.Sprintf(`[!%s]`, key)
+	case f.value == "":
+		return fmt.Sprintf(`[%s]`, key)
+	case f.negate:
+		return fmt.Sprintf(`[%s!=%s]`, key, strconv.Quote(f.value))
+	default:
+		return fmt.Sprintf(`[%s=%s]`, key, strconv.Quote(f.value))
+	}
+}
+
+func (f tagFilter) matches(tags map[string]string) bool {
+	value, ok := tags[f.key]
+
+	if f.value == "" {
+		return ok != f.negate
+	}
+	if f.negate {
+		return !ok || value != f.value
+	}
+	return ok && value == f.value
+}
+
+type PoiCategory struct {
+	Name    string     `json:"name"`
+	Icon    string     `json:"icon"`
+	Filters [][]string `json:"filters"`
+	Exclude []string   `json:"exclude"`
+	Tags    []string   `json:"tags"`
+	// Whether to look up entrances of ways
+	Entrances bool `json:"entrances"`
+
+	// Parsed filters, each selector contains the filters of one alternative
+	// followed by the negated exclusions
+	selectors [][]tagFilter
+	// Hash of the Overpass query, which identifies the cached tiles of the
+	// category
+	definitionHash uint32
+}
+
+func (c *PoiCategory) parse() error {
+	if c.Name == "" {
+		return errors.New("category without name")
+	}
+	if len(c.Filters) == 0 {
+		return fmt.Errorf("category %s has no filters", c.Name)
+	}
+
+	var exclusions []tagFilter
+	for _, exclusion := range c.Exclude {
+		filter, err := parseTagFilter(exclusion)
+		if err != nil {
+			return fmt.Errorf("category %s: %w", c.Name, err)
+		}
+		filter.negate = !filter.negate
+		exclusions = append(exclusions, filter)
+	}
+
+	c.selectors = nil
+	for _, filters := range c.Filters {
+		if len(filters) == 0 {
+			return fmt.Errorf("category %s has an empty filter", c.Name)
+		}
+
+		var selector []tagFilter
+		for _, filterText := range filters {
+			filter, err := parseTagFilter(filterText)
+			if err != nil {
+				return fmt.Errorf("category %s: %w", c.Name, err)
+			}
+			selector = append(selector, filter)
+		}
+
+		c.selectors = append(c.selectors, append(selector, exclusions...))
+	}
+
+	definition := fnv.New32a()
+	definition.Write([]byte(c.overpassQuery("")))
+	c.definitionHash = definition.Sum32()
+
+	return nil
+}
+
+// Evaluates the category locally, like Overpass would.
+func (c PoiCategory) matches(tags map[string]string) bool {
+	for _, selector := range c.selectors {
+		if !slices.ContainsFunc(selector, func(f tagFilter) bool { return !f.matches(tags) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// Builds the Overpass QL query for the category. The area is an Overpass
+// spatial filter without parentheses, e.g. "around:1000,52.5,13.4" or a
+// bounding box "south,west,north,east".
+func (c PoiCategory) overpassQuery(area string) string {
+	return PoiCategories{c}.overpassQuery(area)
+}
+
+// Builds a single Overpass QL query for the union of the categories.
+func (c PoiCategories) overpassQuery(area string) string {
+	var query strings.Builder
+
+	entrances := false
+
+	query.WriteString("[out:json];(")
+	for _, category := range c {
+		for _, selector := range category.selectors {
+			query.WriteString("nwr")
+			for _, filter := range selector {
+				query.WriteString(filter.String())
+			}
+			fmt.Fprintf(&query, "(%s);", area)
+		}
+		entrances = entrances || category.Entrances
+	}
+	query.WriteString(");")
+	if entrances {
+		query.WriteString(`(._;node(w)["entrance"];);`)
+	}
+	query.WriteString("out geom;")
+
+	return query.String()
+}
+
+// Splits the elements of a query for the union of the categories by category,
+// an element may belong to several categories.
+func (c PoiCategories) split(elements []overpassElement) map[string][]overpassElement {
+	split := map[string][]overpassElement{}
+
+	for _, category := range c {
+		categoryElements := []overpassElement{}
+		for _, element := range elements {
+			entrance := element.OverpassType == "node" && element.Tags["entrance"] != ""
+			if category.matches(element.Tags) || (category.Entrances && entrance) {
+				categoryElements = append(categoryElements, element)
+			}
+		}
+		split[category.Name] = category.attachEntrances(categoryElements)
+	}
+
+	return split
+}
+
+// Sets the entrances of ways from the entrance nodes in the elements and
+// removes the nodes, that don't belong to the category themselves.
+func (c PoiCategory) attachEntrances(elements []overpassElement) []overpassElement {
+	if !c.Entrances {
+		return elements
+	}
+
+	entrances := map[int64]overpassPoint{}
+	var attached []overpassElement
+
+	for _, element := range elements {
+		if element.OverpassType == "node" && element.Tags["entrance"] != "" {
+			entrances[element.ID] = overpassPoint{Lat: element.Lat, Lon: element.Lon}
+			if !c.matches(element.Tags) {
+				continue
+			}
+		}
+		attached = append(attached, element)
+	}
+
+	for i, element := range attached {
+		if element.OverpassType != "way" {
+			continue
+		}
+		for _, node := range element.Nodes {
+			if entrance, ok := entrances[node]; ok {
+				attached[i].Entrance = &entrance
+				break
+			}
+		}
+	}
+
+	return attached
+}
+
+// Returns the configured tags of the element.
+func (c PoiCategory) exposedTags(tags map[string]string) map[string]string {
+	exposed := map[string]string{}
+	for _, key := range c.Tags {
+		if value, ok := tags[key]; ok {
+			exposed[key] = value
+		}
+	}
+
+	if len(exposed) == 0 {
+		return nil
+	}
+	return exposed
+}
+
+// All categories in the order of the configuration file
+type PoiCategories []PoiCategory
+
+// Loads the categories from the given file, or the embedded default
+// categories, if path is empty.
+func LoadPoiCategories(path string) (PoiCategories, error) {
+	data := defaultPoiCategories
+
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return parsePoiCategories(data)
+}
+
+func parsePoiCategories(data []byte) (PoiCategories, error) {
+	var categories PoiCategories
+	if err := json.Unmarshal(data, &categories); err != nil {
+		return nil, fmt.Errorf("invalid POI categories: %w", err)
+	}
+
+	names := map[string]bool{}
+	for i := range categories {
+		if err := categories[i].parse(); err != nil {
+			return nil, err
+		}
+		if names[categories[i].Name] {
+			return nil, fmt.Errorf("duplicate category %s", categories[i].Name)
+		}
+		names[categories[i].Name] = true
+	}
+
+	return categories, nil
+}
+
+func (c PoiCategories) Get(name string) (PoiCategory, bool) {
+	index := slices.IndexFunc(c, func(category PoiCategory) bool { return category.Name == name })
+	if index < 0 {
+		return PoiCategory{}, false
+	}
+	return c[index], true
+}
+
+// Names of all categories that match the tags.
+func (c PoiCategories) matching(tags map[string]string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	var names []string
+	for _, category := range c {
+		if category.matches(tags) {
+			names = append(names, category.Name)
+		}
+	}
+	return names
+}
+
+// Returns the named categories without duplicates, or ErrUnknownCategory if
+// one of them doesn't exist.
+func (c PoiCategories) subset(names []string) (PoiCategories, error) {
+	var selected PoiCategories
+	for _, name := range names {
+		category, ok := c.Get(name)
+		if !ok {
+			return nil, ErrUnknownCategory
+		}
+		if !slices.ContainsFunc(selected, func(s PoiCategory) bool { return s.Name == name }) {
+			selected = append(selected, category)
+		}
+	}
+	return selected, nil
+}
+
+// Returns true, if one of the named categories looks up entrances.
+func (c PoiCategories) withEntrances(names []string) bool {
+	for _, name := range names {
+		if category, ok := c.Get(name); ok && category.Entrances {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// POI details
+
+var ErrPoiNotFound = errors.New("POI not found")
+
+// Returns whether the OSM element type is valid, i.e. node, way or relation.
+func ValidOsmType(osmType string) bool {
+	switch osmType {
+	case "node", "way", "relation":
+		return true
+	default:
+		return false
+	}
+}
+
+// Interprets the common yes/no values of OSM tags. Returns nil for missing or
+// unknown values, including access values like designated or permissive,
+// which say who may use something, not whether it exists.
+func parseYesNo(value string) *bool {
+	var result bool
+
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "true", "1":
+		result = true
+	case "no", "false", "0":
+		result = false
+	default:
+		return nil
+	}
+
+	return &result
+}
+
+// Returns the first of the tags that is set.
+func firstTag(tags map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := tags[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func newPoiDetails(element overpassElement) models.PoiDetails {
+	location := element.location()
+	tags := element.Tags
+
+	details := models.PoiDetails{
+		OsmType:      element.OverpassType,
+		OsmId:        element.ID,
+		Lon:          float64(location.Lon),
+		Lat:          float64(location.Lat),
+		Name:         tags["name"],
+		Address:      element.GetAddress(),
+		Website:      firstTag(tags, "website", "contact:website", "url"),
+		Phone:        firstTag(tags, "phone", "contact:phone", "contact:mobile"),
+		Email:        firstTag(tags, "email", "contact:email"),
+		Operator:     tags["operator"],
+		OpeningHours: tags["opening_hours"],
+		Fee:          parseYesNo(tags["fee"]),
+		Charge:       tags["charge"],
+		Tents:        parseYesNo(tags["tents"]),
+		PowerSupply:  parseYesNo(tags["power_supply"]),
+		Surface:      tags["surface"],
+		Tags:         tags,
+	}
+
+	if details.Tags == nil {
+		details.Tags = map[string]string{}
+	}
+
+	// A charge implies a fee, even if the fee tag is missing
+	if details.Fee == nil && details.Charge != "" {
+		details.Fee = parseYesNo("yes")
+	}
+
+	if capacity, err := strconv.ParseInt(strings.TrimSpace(tags["capacity"]), 10, 64); err == nil {
+		details.Capacity = &capacity
+	}
+
+	// Showers are tagged with their temperature, e.g. shower=hot
+	switch tags["shower"] {
+	case "hot", "cold":
+		details.Shower = parseYesNo("yes")
+	default:
+		details.Shower = parseYesNo(tags["shower"])
+	}
+
+	// Drinking water amenities are potable, unless tagged otherwise
+	details.DrinkingWater = parseYesNo(tags["drinking_water"])
+	if details.DrinkingWater == nil && tags["amenity"] == "drinking_water" {
+		details.DrinkingWater = parseYesNo("yes")
+	}
+
+	switch tags["wheelchair"] {
+	case "yes", "limited", "no":
+		details.Wheelchair = tags["wheelchair"]
+	case "designated":
+		details.Wheelchair = "yes"
+	}
+
+	return details
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrNoElevation = errors.New("no elevation data")
+
+// Elevation of the terrain
+type ElevationService interface {
+	// Returns the elevation in m, or ErrNoElevation outside of the data
+	Elevation(lon float64, lat float64) (float64, error)
+}
+
+// Elevation from SRTM HGT tiles in a local directory. Each file covers one
+// degree, named after its south-west corner like N52E013.hgt, and holds a
+// square grid of big-endian 16-bit elevations from north to south. Both SRTM1
+// (3601 samples per row) and SRTM3 (1201) are supported, Copernicus DEM can
+// be converted with GDAL (gdal_translate -of SRTMHGT).
+//
+// SRTM1 tiles take 26 MB each, so only the recently used tiles are kept.
+type demElevationService struct {
+	dir string
+
+	mutex sync.Mutex
+	// Tiles by file name
+	tiles map[string]*hgtEntry
+	// Incremented with every access, for evicting the least recently used
+	// tile
+	clock uint64
+}
+
+// Tile of the cache, which is loaded once outside of the mutex. The tile is
+// nil, if the file does not exist.
+type hgtEntry struct {
+	once     sync.Once
+	tile     *hgtTile
+	err      error
+	lastUsed uint64
+}
+
+type hgtTile struct {
+	size    int
+	samples []int16
+}
+
+// Marks samples without data
+const hgtVoid = math.MinInt16
+
+// Maximum number of cached tiles
+const maxHgtTiles = 16
+
+func NewDemElevationService(dir string) ElevationService {
+	return &demElevationService{
+		dir:   dir,
+		tiles: map[string]*hgtEntry{},
+	}
+}
+
+// Returns the file name of the tile, that contains the location.
+func hgtFileName(lon float64, lat float64) string {
+	latFloor := int(math.Floor(lat))
+	lonFloor := int(math.Floor(lon))
+
+	latPrefix, lonPrefix := "N", "E"
+	if latFloor < 0 {
+		latPrefix = "S"
+	}
+	if lonFloor < 0 {
+		lonPrefix = "W"
+	}
+
+	return fmt.Sprintf("%s%02d%s%03d.hgt", latPrefix, abs(latFloor), lonPrefix, abs(lonFloor))
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func loadHgtTile(path string) (*hgtTile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int
+	switch len(data) {
+	case 3601 * 3601 * 2:
+		size = 3601
+	case 1201 * 1201 * 2:
+		size = 1201
+	default:
+		return nil, fmt.Errorf("unexpected size %d of %s", len(data), path)
+	}
+
+	tile := &hgtTile{size: size, samples: make([]int16, size*size)}
+	for i := range tile.samples {
+		tile.samples[i] = int16(binary.BigEndian.Uint16(data[2*i:]))
+	}
+
+	return tile, nil
+}
+
+func (s *demElevationService) tile(name string) (*hgtTile, error) {
+	s.mutex.Lock()
+	entry, ok := s.tiles[name]
+	if !ok {
+		s.evict()
+		entry = &hgtEntry{}
+		s.tiles[name] = entry
+	}
+	s.clock++
+	entry.lastUsed = s.clock
+	s.mutex.Unlock()
+
+	// Concurrent requests for the same tile wait for the first one
+	entry.once.Do(func() {
+		entry.tile, entry.err = loadHgtTile(filepath.Join(s.dir, name))
+
+		// Missing tiles are remembered as well, e.g. over the sea
+		if errors.Is(entry.err, os.ErrNotExist) {
+			entry.tile, entry.err = nil, nil
+		}
+	})
+
+	if entry.err != nil {
+		log.Println("Could not load elevation tile:", entry.err)
+
+		// Other errors are retried with the next request
+		s.mutex.Lock()
+		if s.tiles[name] == entry {
+			delete(s.tiles, name)
+		}
+		s.mutex.Unlock()
+
+		return nil, entry.err
+	}
+
+	return entry.tile, nil
+}
+
+// Removes the least recently used tile, if the cache is full. Must be called
+// with the mutex held.
+func (s *demElevationService) evict() {
+	if len(s.tiles) < maxHgtTiles {
+		return
+	}
+
+	var oldest string
+	for name, entry := range s.tiles {
+		if oldest == "" || entry.lastUsed < s.tiles[oldest].lastUsed {
+			oldest = name
+		}
+	}
+	delete(s.tiles, oldest)
+}
+
+func (s *demElevationService) Elevation(lon float64, lat float64) (float64, error) {
+	tile, err := s.tile(hgtFileName(lon, lat))
+	if err != nil {
+		return 0, err
+	}
+	if tile == nil {
+		return 0, ErrNoElevation
+	}
+
+	// Position in the grid, the first row is the northern edge
+	x := (lon - math.Floor(lon)) * float64(tile.size-1)
+	y := (math.Floor(lat) + 1 - lat) * float64(tile.size-1)
+
+	x0 := min(int(x), tile.size-2)
+	y0 := min(int(y), tile.size-2)
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	// Bilinear interpolation of the surrounding samples, voids are left out
+	var sum, weights float64
+	for _, corner := range []struct {
+		dx, dy int
+		weight float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		sample := tile.samples[(y0+corner.dy)*tile.size+x0+corner.dx]
+		if sample == hgtVoid || corner.weight == 0 {
+			continue
+		}
+		sum += float64(sample) * corner.weight
+		weights += corner.weight
+	}
+
+	if weights == 0 {
+		return 0, ErrNoElevation
+	}
+	return sum / weights, nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// Failover between weather providers
+//
+// Providers are tried in the configured order until one of them answers. A
+// provider that failed maxFailures times in a row is considered unhealthy and
+// skipped for the cooldown period. If all providers are unhealthy, they are
+// tried anyway, because a late answer is better than none.
+type failoverProvider struct {
+	name           string
+	service        WeatherService
+	failures       int
+	unhealthyUntil time.Time
+}
+
+type failoverWeatherService struct {
+	mu          sync.Mutex
+	providers   []*failoverProvider
+	maxFailures int
+	cooldown    time.Duration
+	now         func() time.Time
+}
+
+// Creates a weather service that fails over between the given providers, which
+// are looked up in the provider registry.
+func NewFailoverWeatherService(providerNames []string, config WeatherProviderConfig, maxFailures int, cooldown time.Duration) (WeatherService, error) {
+	if len(providerNames) == 0 {
+		return nil, errors.New("at least one weather provider is required")
+	}
+
+	var providers []*failoverProvider
+
+	for _, name := range providerNames {
+		service, err := NewWeatherService(name, config)
+		if err != nil {
+			return nil, err
+		}
+
+		providers = append(providers, &failoverProvider{name: name, service: service})
+	}
+
+	return newFailoverWeatherService(providers, maxFailures, cooldown), nil
+}
+
+func newFailoverWeatherService(providers []*failoverProvider, maxFailures int, cooldown time.Duration) *failoverWeatherService {
+	return &failoverWeatherService{
+		providers:   providers,
+		maxFailures: max(maxFailures, 1),
+		cooldown:    cooldown,
+		now:         time.Now,
+	}
+}
+
+func (s *failoverWeatherService) GetWeatherForecast(lon float64, lat float64) (models.WeatherSummary, error) {
+	var (
+		errs    []error
+		skipped []*failoverProvider
+	)
+
+	for _, provider := range s.providers {
+		if !s.isHealthy(provider) {
+			skipped = append(skipped, provider)
+			continue
+		}
+
+		weatherSummary, err := s.try(provider, lon, lat)
+		if err == nil {
+			return weatherSummary, nil
+		}
+		errs = append(errs, err)
+	}
+
+	// Last resort, all healthy providers failed
+	for _, provider := range skipped {
+		weatherSummary, err := s.try(provider, lon, lat)
+		if err == nil {
+			return weatherSummary, nil
+		}
+		errs = append(errs, err)
+	}
+
+	return models.WeatherSummary{}, errors.Join(errs...)
+}
+
+func (s *failoverWeatherService) isHealthy(provider *failoverProvider) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return !s.now().Before(provider.unhealthyUntil)
+}
+
+// Requests the forecast from a single provider and updates its health.
+func (s *failoverWeatherService) try(provider *failoverProvider, lon float64, lat float64) (models.WeatherSummary, error) {
+	weatherSummary, err := provider.service.GetWeatherForecast(lon, lat)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		provider.failures++
+
+		if provider.failures >= s.maxFailures {
+			provider.failures = 0
+			provider.unhealthyUntil = s.now().Add(s.cooldown)
+			log.Printf("Weather provider %s failed %d times, skipping it for %v", provider.name, s.maxFailures, s.cooldown)
+		}
+
+		return models.WeatherSummary{}, fmt.Errorf("%s: %w", provider.name, err)
+	}
+
+	provider.failures = 0
+	provider.unhealthyUntil = time.Time{}
+
+	if weatherSummary.Source == "" {
+		weatherSummary.Source = provider.name
+	}
+
+	return weatherSummary, nil
+}
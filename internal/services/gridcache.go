@@ -0,0 +1,151 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache statistics, exposed by all caching services.
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+type Cache interface {
+	Stats() CacheStats
+}
+
+// In-memory cache of values by grid cell
+//
+// Coordinates are snapped to a grid with the given resolution (in degrees), so
+// that riders close to each other share one value, which is requested for the
+// center of the grid cell. Concurrent requests for the same cell are coalesced
+// into a single upstream request. The weather and alert caches only differ in
+// the expiry of their entries.
+type gridCacheKey struct {
+	lon, lat int64
+}
+
+type gridCacheEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// Upstream request in progress, other requests for the same cell wait for it
+// to finish.
+type gridCacheCall[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+type gridCache[T any] struct {
+	resolution float64
+	// Returns when an entry, that is stored at the given time, expires
+	expires func(now time.Time) time.Time
+
+	mu        sync.Mutex
+	entries   map[gridCacheKey]gridCacheEntry[T]
+	calls     map[gridCacheKey]*gridCacheCall[T]
+	nextSweep time.Time
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	now func() time.Time
+}
+
+func newGridCache[T any](resolution float64, expires func(now time.Time) time.Time) *gridCache[T] {
+	return &gridCache[T]{
+		resolution: resolution,
+		expires:    expires,
+		entries:    map[gridCacheKey]gridCacheEntry[T]{},
+		calls:      map[gridCacheKey]*gridCacheCall[T]{},
+		now:        time.Now,
+	}
+}
+
+func (c *gridCache[T]) key(lon float64, lat float64) gridCacheKey {
+	return gridCacheKey{
+		lon: int64(math.Round(lon / c.resolution)),
+		lat: int64(math.Round(lat / c.resolution)),
+	}
+}
+
+// Returns the value of the grid cell, that contains the coordinates. On a miss
+// fetch is called with the center of the cell.
+func (c *gridCache[T]) get(lon float64, lat float64, fetch func(lon float64, lat float64) (T, error)) (T, error) {
+	key := c.key(lon, lat)
+	now := c.now()
+
+	c.mu.Lock()
+
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expires) {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return entry.value, nil
+	}
+
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-call.done
+		c.hits.Add(1)
+		return call.value, call.err
+	}
+
+	call := &gridCacheCall[T]{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+
+	call.value, call.err = fetch(
+		float64(key.lon)*c.resolution,
+		float64(key.lat)*c.resolution,
+	)
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	if call.err == nil {
+		c.sweep(now)
+		c.entries[key] = gridCacheEntry[T]{
+			value:   call.value,
+			expires: c.expires(now),
+		}
+	}
+	c.mu.Unlock()
+
+	close(call.done)
+
+	return call.value, call.err
+}
+
+// Removes expired entries at most once per lifetime of an entry. Must be called
+// with the mutex held.
+func (c *gridCache[T]) sweep(now time.Time) {
+	if now.Before(c.nextSweep) {
+		return
+	}
+
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.nextSweep = c.expires(now)
+}
+
+func (c *gridCache[T]) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: len(c.entries),
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// MET Norway (Yr)
+//
+// Locationforecast 2.0 of the Norwegian Meteorological Institute, see
+// https://api.met.no/weatherapi/locationforecast/2.0/documentation. The terms
+// of service require an identifying User-Agent and coordinates with at most
+// four decimals.
+type metNorwayService struct {
+	forecastUrl      string
+	userAgent        string
+	forecastHours    int64
+	forecastInterval int // in hours
+}
+
+func NewMetNorwayService(userAgent string, forecastHours int64) WeatherService {
+	return &metNorwayService{
+		forecastUrl:      "https://api.met.no/weatherapi/locationforecast/2.0/complete",
+		userAgent:        userAgent,
+		forecastHours:    forecastHours,
+		forecastInterval: 3,
+	}
+}
+
+type metNorwayDetails struct {
+	AirTemperature             float64 `json:"air_temperature"`
+	RelativeHumidity           float64 `json:"relative_humidity"`
+	CloudAreaFraction          float64 `json:"cloud_area_fraction"`
+	WindSpeed                  float64 `json:"wind_speed"`
+	WindFromDirection          float64 `json:"wind_from_direction"`
+	WindSpeedOfGust            float64 `json:"wind_speed_of_gust"`
+	PrecipitationAmount        float64 `json:"precipitation_amount"`
+	ProbabilityOfPrecipitation float64 `json:"probability_of_precipitation"`
+}
+
+// Forecast of the period after an entry, e.g. the precipitation of the next
+// hour.
+type metNorwayPeriod struct {
+	Summary struct {
+		SymbolCode string `json:"symbol_code"`
+	} `json:"summary"`
+	Details metNorwayDetails `json:"details"`
+}
+
+type metNorwayResponse struct {
+	Properties struct {
+		Timeseries []struct {
+			Time time.Time `json:"time"`
+			Data struct {
+				Instant struct {
+					Details metNorwayDetails `json:"details"`
+				} `json:"instant"`
+				NextOneHour  *metNorwayPeriod `json:"next_1_hours"`
+				NextSixHours *metNorwayPeriod `json:"next_6_hours"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"properties"`
+}
+
+// Maps the weather symbols, e.g. "lightrainshowers_day", to OpenWeatherMap
+// condition ids.
+func metNorwayCondition(symbolCode string) int64 {
+	symbol, _, _ := strings.Cut(symbolCode, "_")
+
+	switch {
+	case symbol == "":
+		return 0
+	case strings.Contains(symbol, "thunder"):
+		return 211
+	case strings.Contains(symbol, "sleet"):
+		return 611
+	case strings.Contains(symbol, "snow"):
+		return 600
+	case strings.HasPrefix(symbol, "heavyrain"):
+		return 502
+	case strings.HasPrefix(symbol, "lightrain"):
+		return 500
+	case strings.Contains(symbol, "rain"):
+		return 501
+	case symbol == "fog":
+		return 741
+	case symbol == "clearsky":
+		return 800
+	case symbol == "fair":
+		return 801
+	case symbol == "partlycloudy":
+		return 802
+	case symbol == "cloudy":
+		return 804
+	default:
+		return 0
+	}
+}
+
+func (s *metNorwayService) GetWeatherForecast(lon float64, lat float64) (models.WeatherSummary, error) {
+	query := fmt.Sprintf("?lat=%.4f&lon=%.4f", lat, lon)
+
+	var response metNorwayResponse
+	if err := getJSON(s.forecastUrl+query, s.userAgent, &response); err != nil {
+		log.Println("Error when fetching weather from met.no:", err)
+		return models.WeatherSummary{}, err
+	}
+
+	now := time.Now()
+	end := now.Truncate(time.Hour).Add(time.Duration(s.forecastHours) * time.Hour)
+
+	var hours []hourlyForecast
+	for _, entry := range response.Properties.Timeseries {
+		if !entry.Time.Before(end) {
+			break
+		}
+
+		// Only the first ~2.5 days have an hourly resolution, later entries
+		// are in 6-hour steps and are spread over the hours of their period.
+		period, periodHours := entry.Data.NextOneHour, 1
+		if period == nil {
+			period, periodHours = entry.Data.NextSixHours, 6
+		}
+		if period == nil {
+			break
+		}
+
+		instant := entry.Data.Instant.Details
+
+		for hour := range periodHours {
+			hourTime := entry.Time.Add(time.Duration(hour) * time.Hour)
+			if !hourTime.Before(end) {
+				break
+			}
+
+			hours = append(hours, hourlyForecast{
+				timestamp:     hourTime.Unix(),
+				temp:          instant.AirTemperature,
+				humidity:      instant.RelativeHumidity,
+				windSpeed:     instant.WindSpeed,
+				windDeg:       instant.WindFromDirection,
+				windGust:      instant.WindSpeedOfGust,
+				precipitation: period.Details.PrecipitationAmount / float64(periodHours),
+				pop:           period.Details.ProbabilityOfPrecipitation / 100,
+				clouds:        instant.CloudAreaFraction,
+				condition:     metNorwayCondition(period.Summary.SymbolCode),
+			})
+		}
+	}
+
+	weatherForecast := models.WeatherForecast{
+		List: aggregateHourlyForecast(hours, now, s.forecastInterval),
+		City: models.City{
+			Coord: models.Location{Lon: models.Coordinate(lon), Lat: models.Coordinate(lat)},
+		},
+	}
+	weatherForecast.Count = int64(len(weatherForecast.List))
+
+	return newWeatherSummary(weatherForecast, "metno")
+}
@@ -0,0 +1,481 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// Short-term rain forecast from weather radar
+type NowcastService interface {
+	GetNowcast(lon float64, lat float64) ([]models.NowcastStep, error)
+}
+
+var nowcastProviders = map[string]func(minutes int64) NowcastService{
+	"rainviewer": NewRainViewerService,
+}
+
+// Returns the names of all available nowcast providers in alphabetical order.
+func NowcastProviders() []string {
+	return slices.Sorted(maps.Keys(nowcastProviders))
+}
+
+// Creates the nowcast service registered under the given provider name, that
+// forecasts the given number of minutes.
+func NewNowcastService(provider string, minutes int64) (NowcastService, error) {
+	factory, ok := nowcastProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown nowcast provider %q, available providers: %s",
+			provider,
+			strings.Join(NowcastProviders(), ", "))
+	}
+
+	return factory(minutes), nil
+}
+
+const (
+	nowcastStep = 5 * time.Minute
+	// Radar tiles, zoom 7 is the highest zoom level RainViewer offers
+	radarZoom     = 7
+	radarTileSize = 256
+	// Reflectivity of the pixel values in color scheme 0: the gray value
+	// minus the offset is the reflectivity in dBZ, 0 means no echo
+	radarDbzOffset = 32
+	// Half size (in pixels) of the area around the location in which the
+	// motion of the rain is estimated, and the maximum motion between two
+	// frames
+	radarMotionWindow = 128
+	radarMaxShift     = 16
+	// Size (in pixels) of the grid cells, in which the motion is estimated
+	// once per frame
+	radarMotionCell = 16
+	// Maximum number of cached tiles and motions
+	maxRadarTiles   = 512
+	maxRadarMotions = 4096
+	// RainViewer adds a frame every 10 minutes
+	radarMapsTtl = time.Minute
+	// Web Mercator maps end at this latitude (in degrees)
+	maxRadarLatitude = 85.0511
+)
+
+// RainViewer
+//
+// Radar composites of the past two hours in 10 minute steps, see
+// https://www.rainviewer.com/api.html. RainViewer offers no forecast, so the
+// rain is moved along the motion between the two latest frames (advection).
+//
+// The list of frames is refreshed once per minute. Tiles and the estimated
+// motion of the grid cells are cached until the next frame is available.
+type rainViewerService struct {
+	mapsUrl string
+	minutes int64
+
+	mutex      sync.Mutex
+	radarMaps  rainViewerMaps
+	mapsExpire time.Time
+	// Decoded tiles by URL, only tiles of the current frames are kept
+	tiles map[string]*image.Gray
+	// Motions of the grid cells, only motions of the latest frame are kept
+	motions map[radarMotionKey][2]float64
+	// Running motion estimations, concurrent requests for the same cell wait
+	// for them like in the weather cache
+	motionCalls map[radarMotionKey]*radarMotionCall
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type radarMotionKey struct {
+	frame        string
+	cellX, cellY int
+}
+
+type radarMotionCall struct {
+	done   chan struct{}
+	motion [2]float64
+}
+
+func NewRainViewerService(minutes int64) NowcastService {
+	return &rainViewerService{
+		mapsUrl: "https://api.rainviewer.com/public/weather-maps.json",
+		minutes: minutes,
+		tiles:   map[string]*image.Gray{},
+		motions: map[radarMotionKey][2]float64{},
+
+		motionCalls: map[radarMotionKey]*radarMotionCall{},
+	}
+}
+
+type rainViewerMaps struct {
+	Host  string `json:"host"`
+	Radar struct {
+		Past []rainViewerFrame `json:"past"`
+	} `json:"radar"`
+}
+
+type rainViewerFrame struct {
+	Time int64  `json:"time"`
+	Path string `json:"path"`
+}
+
+// The 3x3 tiles around a location, row by row. Tiles outside of the map are
+// nil.
+type radarMosaic struct {
+	time  time.Time
+	tiles [9]*image.Gray
+}
+
+const radarMosaicSize = 3 * radarTileSize
+
+// Returns the rain rate in mm/h at the pixel of the mosaic.
+func (m radarMosaic) at(x int, y int) float64 {
+	if x < 0 || y < 0 || x >= radarMosaicSize || y >= radarMosaicSize {
+		return 0
+	}
+
+	tile := m.tiles[y/radarTileSize*3+x/radarTileSize]
+	if tile == nil {
+		return 0
+	}
+
+	tx, ty := x%radarTileSize, y%radarTileSize
+	bounds := tile.Bounds()
+	if tx >= bounds.Dx() || ty >= bounds.Dy() {
+		return 0
+	}
+	return radarRainRates[tile.Pix[tile.PixOffset(bounds.Min.X+tx, bounds.Min.Y+ty)]]
+}
+
+// Rain rates of the pixel values, 0 means no echo
+var radarRainRates = func() (rates [256]float64) {
+	for value := 1; value < len(rates); value++ {
+		rates[value] = rainRate(float64(value) - radarDbzOffset)
+	}
+	return rates
+}()
+
+// Converts the reflectivity into a rain rate in mm/h after Marshall and
+// Palmer (Z = 200 R^1.6).
+func rainRate(dbz float64) float64 {
+	return math.Pow(math.Pow(10, dbz/10)/200, 1/1.6)
+}
+
+// Returns the pixel coordinates of the location in the Web Mercator
+// projection at the radar zoom level.
+func radarPixel(lon float64, lat float64) (float64, float64) {
+	worldSize := float64(radarTileSize << radarZoom)
+	latRadians := lat * math.Pi / 180
+
+	x := (lon + 180) / 360 * worldSize
+	y := (1 - math.Log(math.Tan(latRadians)+1/math.Cos(latRadians))/math.Pi) / 2 * worldSize
+
+	return x, y
+}
+
+func (s *rainViewerService) GetNowcast(lon float64, lat float64) ([]models.NowcastStep, error) {
+	if math.IsNaN(lat) || math.Abs(lat) > maxRadarLatitude {
+		return nil, fmt.Errorf("latitude %f is outside of the radar map", lat)
+	}
+
+	radarMaps, err := s.maps()
+	if err != nil {
+		log.Println("Error when fetching radar maps from rainviewer:", err)
+		return nil, err
+	}
+
+	frames := radarMaps.Radar.Past
+	if len(frames) < 2 {
+		return nil, fmt.Errorf("expected at least 2 radar frames, but got %d", len(frames))
+	}
+	frames = frames[len(frames)-2:]
+
+	x, y := radarPixel(lon, lat)
+	tileX, tileY := int(x)/radarTileSize, int(y)/radarTileSize
+
+	s.removeOld(radarMaps.Host, frames)
+
+	var mosaics [2]radarMosaic
+	for i, frame := range frames {
+		mosaic, err := s.mosaic(radarMaps.Host, frame, tileX, tileY)
+		if err != nil {
+			log.Println("Error when fetching radar tiles from rainviewer:", err)
+			return nil, err
+		}
+		mosaics[i] = mosaic
+	}
+
+	// Position of the location within the mosaics
+	px := int(x) - (tileX-1)*radarTileSize
+	py := int(y) - (tileY-1)*radarTileSize
+
+	// The motion is estimated around the center of the grid cell
+	key := radarMotionKey{frame: frames[1].Path, cellX: int(x) / radarMotionCell, cellY: int(y) / radarMotionCell}
+
+	centerX := key.cellX*radarMotionCell + radarMotionCell/2 - (tileX-1)*radarTileSize
+	centerY := key.cellY*radarMotionCell + radarMotionCell/2 - (tileY-1)*radarTileSize
+	motion := s.motion(key, mosaics, centerX, centerY)
+
+	return nowcast(mosaics[0], mosaics[1], motion, px, py, time.Now(), time.Duration(s.minutes)*time.Minute), nil
+}
+
+// Returns the motion of the grid cell, from the cache if possible. Concurrent
+// requests for the same cell are coalesced into a single estimation.
+func (s *rainViewerService) motion(key radarMotionKey, mosaics [2]radarMosaic, centerX int, centerY int) [2]float64 {
+	s.mutex.Lock()
+
+	if motion, ok := s.motions[key]; ok {
+		s.mutex.Unlock()
+		s.hits.Add(1)
+		return motion
+	}
+
+	if call, ok := s.motionCalls[key]; ok {
+		s.mutex.Unlock()
+		<-call.done
+		s.hits.Add(1)
+		return call.motion
+	}
+
+	call := &radarMotionCall{done: make(chan struct{})}
+	s.motionCalls[key] = call
+	s.mutex.Unlock()
+
+	s.misses.Add(1)
+
+	call.motion[0], call.motion[1] = radarMotion(mosaics[0], mosaics[1], centerX, centerY)
+
+	s.mutex.Lock()
+	delete(s.motionCalls, key)
+	evict(s.motions, maxRadarMotions)
+	s.motions[key] = call.motion
+	s.mutex.Unlock()
+
+	close(call.done)
+
+	return call.motion
+}
+
+// Returns the radar maps, which are refreshed at most once per TTL.
+func (s *rainViewerService) maps() (rainViewerMaps, error) {
+	s.mutex.Lock()
+	radarMaps, expires := s.radarMaps, s.mapsExpire
+	s.mutex.Unlock()
+
+	now := time.Now()
+	if now.Before(expires) {
+		return radarMaps, nil
+	}
+
+	if err := getJSON(s.mapsUrl, "", &radarMaps); err != nil {
+		return rainViewerMaps{}, err
+	}
+
+	s.mutex.Lock()
+	s.radarMaps, s.mapsExpire = radarMaps, now.Add(radarMapsTtl)
+	s.mutex.Unlock()
+
+	return radarMaps, nil
+}
+
+// Removes arbitrary entries, until there is room for a new one. Must be
+// called with the mutex held.
+func evict[K comparable, V any](entries map[K]V, maxEntries int) {
+	for key := range entries {
+		if len(entries) < maxEntries {
+			return
+		}
+		delete(entries, key)
+	}
+}
+
+// Extrapolates the rain at the pixel along the motion (in pixels per frame)
+// between the previous and the latest mosaic, in steps from now until the end
+// of the duration.
+func nowcast(previous radarMosaic, latest radarMosaic, motion [2]float64, px int, py int, now time.Time, duration time.Duration) []models.NowcastStep {
+	dx, dy := motion[0], motion[1]
+	interval := latest.time.Sub(previous.time)
+
+	var steps []models.NowcastStep
+	for offset := time.Duration(0); offset <= duration; offset += nowcastStep {
+		stepTime := now.Add(offset)
+
+		// The rain at the location comes from upwind
+		frames := float64(stepTime.Sub(latest.time)) / float64(interval)
+		sourceX := px - int(math.Round(dx*frames))
+		sourceY := py - int(math.Round(dy*frames))
+
+		steps = append(steps, models.NewNowcastStep(stepTime, neighborhoodRate(latest, sourceX, sourceY)))
+	}
+
+	return steps
+}
+
+// Average rain rate of the 3x3 pixels around x and y, which smoothes the
+// pixel noise of the radar.
+func neighborhoodRate(mosaic radarMosaic, x int, y int) float64 {
+	sum := 0.0
+	for ny := y - 1; ny <= y+1; ny++ {
+		for nx := x - 1; nx <= x+1; nx++ {
+			sum += mosaic.at(nx, ny)
+		}
+	}
+	return sum / 9
+}
+
+// Estimates the motion (in pixels) of the rain between the two mosaics, by
+// searching the shift with the smallest squared difference around the pixel.
+// The search compares every second pixel, the best shift is then refined with
+// all pixels, so that the parity of the pixel does not matter. Smaller shifts
+// win ties, so that no rain results in no motion.
+func radarMotion(previous radarMosaic, latest radarMosaic, px int, py int) (float64, float64) {
+	difference := func(dx int, dy int, step int) float64 {
+		sum := 0.0
+		for y := py - radarMotionWindow; y < py+radarMotionWindow; y += step {
+			for x := px - radarMotionWindow; x < px+radarMotionWindow; x += step {
+				d := previous.at(x, y) - latest.at(x+dx, y+dy)
+				sum += d * d
+			}
+		}
+		return sum
+	}
+
+	search := func(minDx, maxDx, minDy, maxDy, step int) (int, int) {
+		bestDx, bestDy := 0, 0
+		bestDifference := math.Inf(1)
+
+		for dy := minDy; dy <= maxDy; dy++ {
+			for dx := minDx; dx <= maxDx; dx++ {
+				difference := difference(dx, dy, step)
+				if difference < bestDifference ||
+					(difference == bestDifference && dx*dx+dy*dy < bestDx*bestDx+bestDy*bestDy) {
+					bestDx, bestDy, bestDifference = dx, dy, difference
+				}
+			}
+		}
+
+		return bestDx, bestDy
+	}
+
+	dx, dy := search(-radarMaxShift, radarMaxShift, -radarMaxShift, radarMaxShift, 2)
+	dx, dy = search(max(dx-1, -radarMaxShift), min(dx+1, radarMaxShift), max(dy-1, -radarMaxShift), min(dy+1, radarMaxShift), 1)
+
+	return float64(dx), float64(dy)
+}
+
+func (s *rainViewerService) tileUrl(host string, frame rainViewerFrame, x int, y int) string {
+	// Color scheme 0 (reflectivity), not smoothed, without snow
+	return fmt.Sprintf("%s%s/%d/%d/%d/%d/0/0_0.png", host, frame.Path, radarTileSize, radarZoom, x, y)
+}
+
+// Removes the cached tiles and motions of frames, that are no longer current.
+func (s *rainViewerService) removeOld(host string, frames []rainViewerFrame) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for tileUrl := range s.tiles {
+		current := false
+		for _, frame := range frames {
+			if strings.HasPrefix(tileUrl, host+frame.Path+"/") {
+				current = true
+			}
+		}
+		if !current {
+			delete(s.tiles, tileUrl)
+		}
+	}
+
+	latest := frames[len(frames)-1].Path
+	for key := range s.motions {
+		if key.frame != latest {
+			delete(s.motions, key)
+		}
+	}
+}
+
+func (s *rainViewerService) Stats() CacheStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return CacheStats{
+		Hits:    s.hits.Load(),
+		Misses:  s.misses.Load(),
+		Entries: len(s.motions),
+	}
+}
+
+func (s *rainViewerService) mosaic(host string, frame rainViewerFrame, tileX int, tileY int) (radarMosaic, error) {
+	mosaic := radarMosaic{time: time.Unix(frame.Time, 0)}
+
+	tileCount := 1 << radarZoom
+
+	for row := range 3 {
+		for column := range 3 {
+			x, y := tileX+column-1, tileY+row-1
+			if y < 0 || y >= tileCount {
+				continue
+			}
+			// Tiles wrap around the antimeridian
+			x = (x + tileCount) % tileCount
+
+			tile, err := s.tile(s.tileUrl(host, frame, x, y))
+			if err != nil {
+				return radarMosaic{}, err
+			}
+			mosaic.tiles[row*3+column] = tile
+		}
+	}
+
+	return mosaic, nil
+}
+
+// Returns the decoded tile, from the cache if possible.
+func (s *rainViewerService) tile(tileUrl string) (*image.Gray, error) {
+	s.mutex.Lock()
+	tile, ok := s.tiles[tileUrl]
+	s.mutex.Unlock()
+	if ok {
+		return tile, nil
+	}
+
+	resp, err := http.Get(tileUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, resp.Request.URL.Host)
+	}
+
+	decoded, err := png.Decode(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tiles may be paletted, only the gray value is used
+	bounds := decoded.Bounds()
+	tile = image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			tile.Set(x, y, decoded.At(x, y))
+		}
+	}
+
+	s.mutex.Lock()
+	evict(s.tiles, maxRadarTiles)
+	s.tiles[tileUrl] = tile
+	s.mutex.Unlock()
+
+	return tile, nil
+}
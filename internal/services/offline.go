@@ -0,0 +1,438 @@
+package services
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+	"github.com/leomfn/rueckenwind/internal/osmpbf"
+)
+
+// Offline POI index
+//
+// Contains all elements of an OSM extract that match one of the POI
+// categories, with the same tag filters as the Overpass queries. Elements are
+// stored like Overpass returns them, so that the conversion into sites is
+// shared with the Overpass service. For lookups, elements are bucketed into
+// grid cells of a fixed size.
+//
+// The index can be built from an .osm.pbf file at startup or imported once
+// with `rueckenwind import` and stored in a much smaller index file. The index
+// must be rebuilt, if the POI categories change.
+type offlineElement struct {
+	Element    overpassElement
+	Categories []string
+}
+
+type poiIndexFile struct {
+	Version  int
+	Elements []offlineElement
+}
+
+const poiIndexVersion = 4
+
+type poiIndexCell struct {
+	x, y int64
+}
+
+type poiIndexId struct {
+	osmType string
+	id      int64
+}
+
+type poiIndex struct {
+	elements []offlineElement
+	cellSize float64
+	cells    map[poiIndexCell][]int
+	ids      map[poiIndexId]int
+}
+
+func newPoiIndex(elements []offlineElement) *poiIndex {
+	index := &poiIndex{
+		elements: elements,
+		cellSize: 0.1,
+		cells:    map[poiIndexCell][]int{},
+		ids:      map[poiIndexId]int{},
+	}
+
+	for i, element := range elements {
+		location := element.Element.location()
+		cell := index.cellOf(float64(location.Lon), float64(location.Lat))
+		index.cells[cell] = append(index.cells[cell], i)
+		index.ids[poiIndexId{osmType: element.Element.OverpassType, id: element.Element.ID}] = i
+	}
+
+	return index
+}
+
+func (i *poiIndex) cellOf(lon float64, lat float64) poiIndexCell {
+	return poiIndexCell{
+		x: int64(math.Floor(lon / i.cellSize)),
+		y: int64(math.Floor(lat / i.cellSize)),
+	}
+}
+
+// Number of elements in the index
+func (i *poiIndex) Len() int {
+	return len(i.elements)
+}
+
+// Returns the elements of the category in all cells that intersect the
+// bounding box of the search radius (in km).
+func (i *poiIndex) around(category string, lon float64, lat float64, radius float64) []overpassElement {
+	south, west, north, east := boundingBox(lon, lat, radius)
+	southWest := i.cellOf(west, south)
+	northEast := i.cellOf(east, north)
+
+	var elements []overpassElement
+
+	for x := southWest.x; x <= northEast.x; x++ {
+		for y := southWest.y; y <= northEast.y; y++ {
+			for _, elementIndex := range i.cells[poiIndexCell{x: x, y: y}] {
+				element := i.elements[elementIndex]
+				if slices.Contains(element.Categories, category) {
+					elements = append(elements, element.Element)
+				}
+			}
+		}
+	}
+
+	return elements
+}
+
+// Returns the element with the given OSM type and id.
+func (i *poiIndex) get(osmType string, id int64) (overpassElement, bool) {
+	elementIndex, ok := i.ids[poiIndexId{osmType: osmType, id: id}]
+	if !ok {
+		return overpassElement{}, false
+	}
+	return i.elements[elementIndex].Element, true
+}
+
+// Writes the index in a compact binary format.
+func (i *poiIndex) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	if err := gob.NewEncoder(writer).Encode(poiIndexFile{Version: poiIndexVersion, Elements: i.elements}); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Loads an index file, or builds the index from an OSM extract, if the path
+// ends with .pbf.
+func LoadPoiIndex(path string, categories PoiCategories) (*poiIndex, error) {
+	if strings.HasSuffix(path, ".pbf") {
+		return BuildPoiIndex(path, categories)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var indexFile poiIndexFile
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(&indexFile); err != nil {
+		return nil, fmt.Errorf("invalid POI index %s: %w", path, err)
+	}
+
+	if indexFile.Version != poiIndexVersion {
+		return nil, fmt.Errorf("POI index %s has version %d, but version %d is required, please import it again",
+			path, indexFile.Version, poiIndexVersion)
+	}
+
+	return newPoiIndex(indexFile.Elements), nil
+}
+
+// Builds the index from an OSM extract in the PBF format. The file is read up
+// to three times: first for the matching elements, then for the ways that are
+// members of matching relations and finally for the coordinates of all nodes
+// that are needed for the geometry of ways and relations, and for entrances.
+func BuildPoiIndex(path string, categories PoiCategories) (*poiIndex, error) {
+	scan := func(handler osmpbf.Handler) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return osmpbf.Scan(bufio.NewReaderSize(file, 1<<20), handler)
+	}
+
+	var (
+		elements  []offlineElement
+		ways      []osmpbf.Way
+		relations []osmpbf.Relation
+		// Node refs of matching ways and member ways of relations
+		wayRefs = map[int64][]int64{}
+	)
+
+	log.Printf("Reading POIs from %s", filepath.Base(path))
+
+	err := scan(osmpbf.Handler{
+		Node: func(node osmpbf.Node) {
+			if names := categories.matching(node.Tags); names != nil {
+				element := overpassElement{OverpassType: "node", ID: node.ID, Lon: node.Lon, Lat: node.Lat, Tags: node.Tags}
+				elements = append(elements, offlineElement{Element: element, Categories: names})
+			}
+		},
+		Way: func(way osmpbf.Way) {
+			if categories.matching(way.Tags) != nil {
+				ways = append(ways, way)
+				wayRefs[way.ID] = way.Refs
+			}
+		},
+		Relation: func(relation osmpbf.Relation) {
+			if categories.matching(relation.Tags) != nil {
+				relations = append(relations, relation)
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Member ways of relations, that don't match a category themselves
+	memberWays := map[int64]bool{}
+	for _, relation := range relations {
+		for _, member := range relation.Members {
+			if _, ok := wayRefs[member.Ref]; member.Type == osmpbf.WayMember && !ok {
+				memberWays[member.Ref] = true
+			}
+		}
+	}
+
+	if len(memberWays) > 0 {
+		err := scan(osmpbf.Handler{
+			Way: func(way osmpbf.Way) {
+				if memberWays[way.ID] {
+					wayRefs[way.ID] = way.Refs
+				}
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	neededNodes := map[int64]bool{}
+	for _, refs := range wayRefs {
+		for _, ref := range refs {
+			neededNodes[ref] = true
+		}
+	}
+	for _, relation := range relations {
+		for _, member := range relation.Members {
+			if member.Type == osmpbf.NodeMember {
+				neededNodes[member.Ref] = true
+			}
+		}
+	}
+
+	nodeLocations := map[int64]models.Location{}
+	entrances := map[int64]bool{}
+
+	if len(neededNodes) > 0 {
+		err := scan(osmpbf.Handler{
+			Node: func(node osmpbf.Node) {
+				if neededNodes[node.ID] {
+					nodeLocations[node.ID] = models.Location{Lon: models.Coordinate(node.Lon), Lat: models.Coordinate(node.Lat)}
+					if node.Tags["entrance"] != "" {
+						entrances[node.ID] = true
+					}
+				}
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Nodes may be missing at the border of an extract
+	appendLocation := func(locations []models.Location, ref int64) []models.Location {
+		if location, ok := nodeLocations[ref]; ok {
+			return append(locations, location)
+		}
+		return locations
+	}
+
+	// Geometry of a way like Overpass returns it
+	geometry := func(refs []int64) []overpassPoint {
+		var points []overpassPoint
+		for _, ref := range refs {
+			if location, ok := nodeLocations[ref]; ok {
+				points = append(points, overpassPoint{Lat: float64(location.Lat), Lon: float64(location.Lon)})
+			}
+		}
+		return points
+	}
+
+	for _, way := range ways {
+		var locations []models.Location
+		for _, ref := range way.Refs {
+			locations = appendLocation(locations, ref)
+		}
+
+		element := overpassElement{OverpassType: "way", ID: way.ID, Tags: way.Tags, Geometry: geometry(way.Refs)}
+		if !element.setBounds(locations) {
+			continue
+		}
+
+		names := categories.matching(way.Tags)
+		if categories.withEntrances(names) {
+			for _, ref := range way.Refs {
+				if location, ok := nodeLocations[ref]; ok && entrances[ref] {
+					element.Entrance = &overpassPoint{Lat: float64(location.Lat), Lon: float64(location.Lon)}
+					break
+				}
+			}
+		}
+
+		elements = append(elements, offlineElement{Element: element, Categories: names})
+	}
+
+	for _, relation := range relations {
+		var locations []models.Location
+		var members []overpassMember
+		for _, member := range relation.Members {
+			switch member.Type {
+			case osmpbf.NodeMember:
+				locations = appendLocation(locations, member.Ref)
+			case osmpbf.WayMember:
+				for _, ref := range wayRefs[member.Ref] {
+					locations = appendLocation(locations, ref)
+				}
+				members = append(members, overpassMember{Type: "way", Ref: member.Ref, Role: member.Role, Geometry: geometry(wayRefs[member.Ref])})
+			}
+		}
+
+		element := overpassElement{OverpassType: "relation", ID: relation.ID, Tags: relation.Tags, Members: members}
+		if !element.setBounds(locations) {
+			continue
+		}
+
+		elements = append(elements, offlineElement{Element: element, Categories: categories.matching(relation.Tags)})
+	}
+
+	log.Printf("Found %d POIs in %s", len(elements), filepath.Base(path))
+
+	return newPoiIndex(elements), nil
+}
+
+// Sets the bounds to the bounding box of the locations. Returns false, if
+// there are no locations.
+func (e *overpassElement) setBounds(locations []models.Location) bool {
+	for i, location := range locations {
+		lon, lat := float64(location.Lon), float64(location.Lat)
+
+		if i == 0 {
+			e.Bounds.MinLon, e.Bounds.MaxLon = lon, lon
+			e.Bounds.MinLat, e.Bounds.MaxLat = lat, lat
+			continue
+		}
+
+		e.Bounds.MinLon = min(e.Bounds.MinLon, lon)
+		e.Bounds.MaxLon = max(e.Bounds.MaxLon, lon)
+		e.Bounds.MinLat = min(e.Bounds.MinLat, lat)
+		e.Bounds.MaxLat = max(e.Bounds.MaxLat, lat)
+	}
+
+	return len(locations) > 0
+}
+
+// Offline POI service
+type offlinePoiService struct {
+	index       *poiIndex
+	categories  PoiCategories
+	maxDistance int64
+}
+
+func NewOfflinePoiService(index *poiIndex, categories PoiCategories, maxDistance int64) PoiService {
+	return &offlinePoiService{
+		index:       index,
+		categories:  categories,
+		maxDistance: maxDistance,
+	}
+}
+
+func (s *offlinePoiService) GetPois(categoryName string, lon float64, lat float64, radius float64) (models.OverpassSites, error) {
+	category, ok := s.categories.Get(categoryName)
+	if !ok {
+		return nil, ErrUnknownCategory
+	}
+
+	radius = searchRadius(radius, s.maxDistance)
+	elements := s.index.around(category.Name, lon, lat, radius)
+	return newPoiSites(elements, category, lon, lat, radius), nil
+}
+
+func (s *offlinePoiService) GetPoisByCategory(categoryNames []string, lon float64, lat float64, radius float64) (map[string]models.OverpassSites, error) {
+	categories, err := s.categories.subset(categoryNames)
+	if err != nil {
+		return nil, err
+	}
+
+	radius = searchRadius(radius, s.maxDistance)
+
+	sites := map[string]models.OverpassSites{}
+	for _, category := range categories {
+		elements := s.index.around(category.Name, lon, lat, radius)
+		sites[category.Name] = newPoiSites(elements, category, lon, lat, radius)
+	}
+
+	return sites, nil
+}
+
+func (s *offlinePoiService) GetPoiDetails(osmType string, id int64) (models.PoiDetails, error) {
+	element, ok := s.index.get(osmType, id)
+	if !ok {
+		return models.PoiDetails{}, ErrPoiNotFound
+	}
+
+	return newPoiDetails(element), nil
+}
+
+// Searches the surroundings of points along the route, that are at most one
+// corridor width apart. The search radius is larger than the corridor, so
+// that the circles also cover the corridor between the points.
+func (s *offlinePoiService) GetPoisAlongRoute(categoryName string, route models.Route, corridor float64, position models.Location) (models.OverpassSites, error) {
+	category, ok := s.categories.Get(categoryName)
+	if !ok {
+		return nil, ErrUnknownCategory
+	}
+
+	route = route.Simplify(routeTolerance)
+
+	var elements []overpassElement
+	found := map[poiIndexId]bool{}
+
+	for _, location := range route.Sample(corridor) {
+		for _, element := range s.index.around(category.Name, float64(location.Lon), float64(location.Lat), 1.5*corridor) {
+			id := poiIndexId{osmType: element.OverpassType, id: element.ID}
+			if !found[id] {
+				found[id] = true
+				elements = append(elements, element)
+			}
+		}
+	}
+
+	return newRouteSites(elements, category, route, corridor, position), nil
+}
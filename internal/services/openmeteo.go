@@ -0,0 +1,144 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// Open-Meteo
+//
+// Free forecast API without API key, see https://open-meteo.com/en/docs
+type openMeteoService struct {
+	forecastUrl      string
+	forecastDays     int64
+	forecastInterval int // in hours
+}
+
+func NewOpenMeteoService(forecastHours int64) WeatherService {
+	return &openMeteoService{
+		forecastUrl: "https://api.open-meteo.com/v1/forecast",
+		// Days start at local midnight, so one more day is needed to cover
+		// the hours from now on
+		forecastDays:     (forecastHours+23)/24 + 1,
+		forecastInterval: 3,
+	}
+}
+
+type openMeteoResponse struct {
+	UtcOffsetSeconds int64 `json:"utc_offset_seconds"`
+	Hourly           struct {
+		Time                     []int64   `json:"time"`
+		Temperature              []float64 `json:"temperature_2m"`
+		RelativeHumidity         []float64 `json:"relative_humidity_2m"`
+		Precipitation            []float64 `json:"precipitation"`
+		PrecipitationProbability []float64 `json:"precipitation_probability"`
+		CloudCover               []float64 `json:"cloud_cover"`
+		WindSpeed                []float64 `json:"wind_speed_10m"`
+		WindDirection            []float64 `json:"wind_direction_10m"`
+		WeatherCode              []float64 `json:"weather_code"`
+		WindGusts                []float64 `json:"wind_gusts_10m"`
+	} `json:"hourly"`
+	Daily struct {
+		Time    []int64 `json:"time"`
+		Sunrise []int64 `json:"sunrise"`
+		Sunset  []int64 `json:"sunset"`
+	} `json:"daily"`
+}
+
+// Maps WMO weather interpretation codes to OpenWeatherMap condition ids.
+func wmoCondition(code int64) int64 {
+	switch {
+	case code == 0:
+		return 800
+	case code == 1:
+		return 801
+	case code == 2:
+		return 802
+	case code == 3:
+		return 804
+	case code == 45 || code == 48:
+		return 741
+	case code >= 51 && code <= 57:
+		return 300
+	case code == 61 || code == 80:
+		return 500
+	case code == 63 || code == 81:
+		return 501
+	case code == 65 || code == 82:
+		return 502
+	case code == 66 || code == 67:
+		return 511
+	case code >= 71 && code <= 77, code == 85, code == 86:
+		return 600
+	case code == 95:
+		return 211
+	case code == 96 || code == 99:
+		return 202
+	default:
+		return 0
+	}
+}
+
+// Returns the value at index i or zero, if the provider omitted the variable.
+func valueAt(values []float64, i int) float64 {
+	if i >= len(values) {
+		return 0
+	}
+	return values[i]
+}
+
+func (s *openMeteoService) GetWeatherForecast(lon float64, lat float64) (models.WeatherSummary, error) {
+	query := fmt.Sprintf("?latitude=%f&longitude=%f&hourly=%s&daily=sunrise,sunset&wind_speed_unit=ms&timezone=auto&timeformat=unixtime&forecast_days=%d",
+		lat,
+		lon,
+		"temperature_2m,relative_humidity_2m,precipitation,precipitation_probability,cloud_cover,wind_speed_10m,wind_direction_10m,wind_gusts_10m,weather_code",
+		s.forecastDays,
+	)
+
+	var response openMeteoResponse
+	if err := getJSON(s.forecastUrl+query, "", &response); err != nil {
+		log.Println("Error when fetching weather from open-meteo:", err)
+		return models.WeatherSummary{}, err
+	}
+
+	hourly := response.Hourly
+	hours := make([]hourlyForecast, len(hourly.Time))
+	for i, timestamp := range hourly.Time {
+		hours[i] = hourlyForecast{
+			timestamp:     timestamp,
+			temp:          valueAt(hourly.Temperature, i),
+			humidity:      valueAt(hourly.RelativeHumidity, i),
+			windSpeed:     valueAt(hourly.WindSpeed, i),
+			windDeg:       valueAt(hourly.WindDirection, i),
+			windGust:      valueAt(hourly.WindGusts, i),
+			precipitation: valueAt(hourly.Precipitation, i),
+			pop:           valueAt(hourly.PrecipitationProbability, i) / 100,
+			clouds:        valueAt(hourly.CloudCover, i),
+			condition:     wmoCondition(int64(valueAt(hourly.WeatherCode, i))),
+		}
+	}
+
+	now := time.Now()
+
+	weatherForecast := models.WeatherForecast{
+		List: aggregateHourlyForecast(hours, now, s.forecastInterval),
+		City: models.City{
+			Coord:    models.Location{Lon: models.Coordinate(lon), Lat: models.Coordinate(lat)},
+			Timezone: response.UtcOffsetSeconds,
+		},
+	}
+	weatherForecast.Count = int64(len(weatherForecast.List))
+
+	// Use the sunset of today, or of tomorrow once it has passed
+	for _, sunset := range response.Daily.Sunset {
+		weatherForecast.City.Sunset = sunset
+		if sunset > now.Unix() {
+			break
+		}
+	}
+
+	return newWeatherSummary(weatherForecast, "open-meteo")
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// Persistent POI cache
+//
+// Raw Overpass elements are stored per category and per tile of a fixed size
+// (in degrees). An element belongs to the tile that contains its location. A
+// search is answered from the cache, if all tiles that intersect the bounding
+// box of the search radius are cached and not older than the TTL.
+//
+// The cache is kept in memory and written to a single JSON file, if a path is
+// given. Writes happen in the background at most once per flush interval, so
+// that a burst of updates results in a single write.
+type poiTileKey struct {
+	x, y int64
+}
+
+type poiTile struct {
+	Fetched  time.Time         `json:"fetched"`
+	Elements []overpassElement `json:"elements"`
+}
+
+// On-disk format, entries are keyed by "<category>-<definition hash>/<x>/<y>"
+type poiCacheFile struct {
+	Version  int                 `json:"version"`
+	TileSize float64             `json:"tile_size"`
+	Tiles    map[string]*poiTile `json:"tiles"`
+}
+
+const poiCacheVersion = 3
+
+// Maximum number of cached tiles, the oldest tiles are evicted first
+const maxPoiTiles = 20000
+
+// Maximum number of tiles, that are requested with a single query. Tiles along
+// a route are requested in several queries, instead of one for the bounding
+// box of the whole route.
+const maxPoiQueryTiles = 16
+
+type poiTileCache struct {
+	path          string
+	tileSize      float64
+	ttl           time.Duration
+	flushInterval time.Duration
+	maxTiles      int
+
+	mu    sync.Mutex
+	tiles map[string]*poiTile
+	dirty bool
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	now func() time.Time
+}
+
+// Creates the cache and loads previously stored tiles from path, if it
+// exists. An empty path keeps the cache in memory only.
+func NewPoiTileCache(path string, tileSize float64, ttl time.Duration) (*poiTileCache, error) {
+	if tileSize <= 0 {
+		return nil, errors.New("tile size must be positive")
+	}
+
+	c := &poiTileCache{
+		path:          path,
+		tileSize:      tileSize,
+		ttl:           ttl,
+		flushInterval: 30 * time.Second,
+		maxTiles:      maxPoiTiles,
+		tiles:         map[string]*poiTile{},
+		now:           time.Now,
+	}
+
+	if path == "" {
+		return c, nil
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	go c.flushLoop()
+
+	return c, nil
+}
+
+func (c *poiTileCache) load() error {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var file poiCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid POI cache file %s: %w", c.path, err)
+	}
+
+	// Tiles of an older format or a different size can't be reused
+	if file.Version != poiCacheVersion || file.TileSize != c.tileSize {
+		log.Printf("Discarding POI cache file %s, it was written with different settings", c.path)
+		return nil
+	}
+
+	if file.Tiles != nil {
+		c.tiles = file.Tiles
+		c.evict()
+	}
+	log.Printf("Loaded %d POI tiles from %s", len(c.tiles), c.path)
+
+	return nil
+}
+
+// Writes the cache to a temporary file, which then replaces the cache file,
+// so that a crash never leaves a truncated file behind. Tiles are never
+// modified after they are stored, so a shallow copy is marshaled without
+// blocking lookups.
+func (c *poiTileCache) save() error {
+	c.mu.Lock()
+	tiles := maps.Clone(c.tiles)
+	c.dirty = false
+	c.mu.Unlock()
+
+	data, err := json.Marshal(poiCacheFile{
+		Version:  poiCacheVersion,
+		TileSize: c.tileSize,
+		Tiles:    tiles,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
+
+func (c *poiTileCache) flushLoop() {
+	for range time.Tick(c.flushInterval) {
+		c.mu.Lock()
+		dirty := c.dirty
+		c.mu.Unlock()
+
+		if !dirty {
+			continue
+		}
+
+		if err := c.save(); err != nil {
+			log.Println("Could not write POI cache:", err)
+		}
+	}
+}
+
+func (c *poiTileCache) tileOf(lon float64, lat float64) poiTileKey {
+	return poiTileKey{
+		x: int64(math.Floor(lon / c.tileSize)),
+		y: int64(math.Floor(lat / c.tileSize)),
+	}
+}
+
+// Tiles are stored per category definition, so that changing the filters of
+// a category doesn't return stale elements.
+func (c *poiTileCache) storageKey(category PoiCategory, tile poiTileKey) string {
+	return fmt.Sprintf("%s-%08x/%d/%d", category.Name, category.definitionHash, tile.x, tile.y)
+}
+
+// Returns all tiles that intersect the bounding box of a circle around the
+// location, with the radius in km.
+func (c *poiTileCache) tilesAround(lon float64, lat float64, radius float64) []poiTileKey {
+	south, west, north, east := boundingBox(lon, lat, radius)
+
+	southWest := c.tileOf(west, south)
+	northEast := c.tileOf(east, north)
+
+	var tiles []poiTileKey
+	for x := southWest.x; x <= northEast.x; x++ {
+		for y := southWest.y; y <= northEast.y; y++ {
+			tiles = append(tiles, poiTileKey{x: x, y: y})
+		}
+	}
+
+	return tiles
+}
+
+// Returns the tiles, that intersect the corridor (in km) around the route, in
+// the order of the route. Like the offline search, circles around points at
+// most one corridor width apart cover the corridor.
+func (c *poiTileCache) tilesAlong(route models.Route, corridor float64) []poiTileKey {
+	var tiles []poiTileKey
+	found := map[poiTileKey]bool{}
+
+	for _, location := range route.Sample(corridor) {
+		for _, tile := range c.tilesAround(float64(location.Lon), float64(location.Lat), 1.5*corridor) {
+			if !found[tile] {
+				found[tile] = true
+				tiles = append(tiles, tile)
+			}
+		}
+	}
+
+	return tiles
+}
+
+// Splits the tiles in their order into groups, whose rectangles of tiles (see
+// bounds) have at most maxTiles tiles.
+func (c *poiTileCache) group(tiles []poiTileKey, maxTiles int) [][]poiTileKey {
+	var groups [][]poiTileKey
+	var group []poiTileKey
+	var minTile, maxTile poiTileKey
+
+	for _, tile := range tiles {
+		if len(group) > 0 {
+			groupMin := poiTileKey{x: min(minTile.x, tile.x), y: min(minTile.y, tile.y)}
+			groupMax := poiTileKey{x: max(maxTile.x, tile.x), y: max(maxTile.y, tile.y)}
+			if (groupMax.x-groupMin.x+1)*(groupMax.y-groupMin.y+1) <= int64(maxTiles) {
+				group = append(group, tile)
+				minTile, maxTile = groupMin, groupMax
+				continue
+			}
+			groups = append(groups, group)
+		}
+
+		group = []poiTileKey{tile}
+		minTile, maxTile = tile, tile
+	}
+
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// Returns the smallest rectangle of tiles that contains all given tiles, with
+// its bounds in degrees.
+func (c *poiTileCache) bounds(tiles []poiTileKey) (covered []poiTileKey, south, west, north, east float64) {
+	minTile, maxTile := tiles[0], tiles[0]
+	for _, tile := range tiles[1:] {
+		minTile.x, minTile.y = min(minTile.x, tile.x), min(minTile.y, tile.y)
+		maxTile.x, maxTile.y = max(maxTile.x, tile.x), max(maxTile.y, tile.y)
+	}
+
+	for x := minTile.x; x <= maxTile.x; x++ {
+		for y := minTile.y; y <= maxTile.y; y++ {
+			covered = append(covered, poiTileKey{x: x, y: y})
+		}
+	}
+
+	south = float64(minTile.y) * c.tileSize
+	west = float64(minTile.x) * c.tileSize
+	north = float64(maxTile.y+1) * c.tileSize
+	east = float64(maxTile.x+1) * c.tileSize
+
+	return covered, south, west, north, east
+}
+
+// Returns the elements of all fresh tiles and the tiles that are missing or
+// expired. Counts as a hit, if all tiles are fresh.
+func (c *poiTileCache) lookup(category PoiCategory, tiles []poiTileKey) (elements []overpassElement, missing []poiTileKey) {
+	elements, missing = c.collect(category, tiles)
+
+	if len(missing) == 0 {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+
+	return elements, missing
+}
+
+func (c *poiTileCache) collect(category PoiCategory, tiles []poiTileKey) (elements []overpassElement, missing []poiTileKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for _, tile := range tiles {
+		cached, ok := c.tiles[c.storageKey(category, tile)]
+		if !ok || now.Sub(cached.Fetched) > c.ttl {
+			missing = append(missing, tile)
+			continue
+		}
+		elements = append(elements, cached.Elements...)
+	}
+
+	return elements, missing
+}
+
+// Replaces the given tiles, which must be completely covered by the query
+// that returned the elements. Elements outside of these tiles, e.g. ways that
+// only intersect the bounding box, are dropped.
+func (c *poiTileCache) store(category PoiCategory, tiles []poiTileKey, elements []overpassElement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fetched := c.now()
+
+	fresh := map[poiTileKey]*poiTile{}
+	for _, tile := range tiles {
+		fresh[tile] = &poiTile{Fetched: fetched, Elements: []overpassElement{}}
+	}
+
+	for _, element := range elements {
+		location := element.location()
+		tile, ok := fresh[c.tileOf(float64(location.Lon), float64(location.Lat))]
+		if !ok {
+			continue
+		}
+		tile.Elements = append(tile.Elements, element)
+	}
+
+	for key, tile := range fresh {
+		c.tiles[c.storageKey(category, key)] = tile
+	}
+
+	// Drop expired tiles of other areas, so that the cache file doesn't grow
+	// forever
+	for key, tile := range c.tiles {
+		if fetched.Sub(tile.Fetched) > c.ttl {
+			delete(c.tiles, key)
+		}
+	}
+	c.evict()
+
+	c.dirty = true
+}
+
+// Removes the oldest tiles, until at most the maximum number of tiles is
+// left. Must be called with the mutex held.
+func (c *poiTileCache) evict() {
+	if len(c.tiles) <= c.maxTiles {
+		return
+	}
+
+	keys := slices.SortedFunc(maps.Keys(c.tiles), func(a string, b string) int {
+		return c.tiles[a].Fetched.Compare(c.tiles[b].Fetched)
+	})
+	for _, key := range keys[:len(keys)-c.maxTiles] {
+		delete(c.tiles, key)
+	}
+}
+
+func (c *poiTileCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: len(c.tiles),
+	}
+}
@@ -3,12 +3,17 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"math"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/leomfn/rueckenwind/internal/locale"
 	"github.com/leomfn/rueckenwind/internal/models"
 )
 
@@ -24,16 +29,16 @@ type openWeatherService struct {
 	forecastInterval int64 // in hours
 }
 
-func NewOpenWeatherService(apiKey string) WeatherService {
+func NewOpenWeatherService(apiKey string, forecastHours int64) WeatherService {
 	return &openWeatherService{
 		forecastUrl:      "https://api.openweathermap.org/data/2.5/forecast",
 		apiKey:           apiKey,
-		maxForecastCount: 2,
+		maxForecastCount: (forecastHours + 2) / 3,
 		forecastInterval: 3,
 	}
 }
 
-// Request weather forecast for next 12 hours in 3-hour blocks (4 items in total)
+// Request weather forecast in 3-hour blocks
 func (s *openWeatherService) GetWeatherForecast(lon float64, lat float64) (models.WeatherSummary, error) {
 	query := fmt.Sprintf("?lat=%f&lon=%f&appid=%s&units=metric&cnt=%d",
 		lat,
@@ -42,111 +47,396 @@ func (s *openWeatherService) GetWeatherForecast(lon float64, lat float64) (model
 		s.maxForecastCount,
 	)
 
-	resp, err := http.Get(s.forecastUrl + query)
-	if err != nil {
+	var weatherForecast models.WeatherForecast
+
+	if err := getJSON(s.forecastUrl+query, "", &weatherForecast); err != nil {
 		log.Println("Error when fetching weather from openweather:", err)
 		return models.WeatherSummary{}, err
 	}
-	defer resp.Body.Close()
 
-	var weatherForecast models.WeatherForecast
+	return newWeatherSummary(weatherForecast, "openweathermap")
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&weatherForecast); err != nil {
-		log.Println("Error when unmarshalling openweathermap response:", err)
-		return models.WeatherSummary{}, err
+// Builds the summary from the first two forecast blocks and keeps all blocks
+// for further analyses. All providers map their native payload into a
+// models.WeatherForecast in 3-hour blocks, so the summary looks the same
+// regardless of the backend. The source is the name of the provider, under
+// which it is registered.
+func newWeatherSummary(weatherForecast models.WeatherForecast, source string) (models.WeatherSummary, error) {
+	if len(weatherForecast.List) < 2 {
+		return models.WeatherSummary{}, errors.New("not enough forecast entries")
 	}
 
 	currentWeather := weatherForecast.List[0]
 	nextWeather := weatherForecast.List[1]
 
 	weatherSummary := models.WeatherSummary{
-		CurrentTemperature: int64(math.Round(currentWeather.Main.Temp)),
-		FutureTemperature:  int64(math.Round(nextWeather.Main.Temp)),
-		CurrentWindSpeed:   int64(math.Round(currentWeather.Wind.Speed * 3.6)),
-		FutureWindSpeed:    int64(math.Round(nextWeather.Wind.Speed * 3.6)),
-		CurrentWindGust:    int64(math.Round(currentWeather.Wind.Gust * 3.6)),
-		FutureWindGust:     int64(math.Round(nextWeather.Wind.Gust * 3.6)),
-		CurrentWindDegrees: currentWeather.Wind.Deg,
-		FutureWindDegrees:  nextWeather.Wind.Deg,
-		CurrentWindScale:   currentWeather.Wind.Scale(),
-		FutureWindScale:    nextWeather.Wind.Scale(),
-		CurrentRain:        currentWeather.Rain.RainIntensity(),
-		FutureRain:         nextWeather.Rain.RainIntensity(),
-		CurrentRainText:    currentWeather.Rain.RainText(),
-		FutureRainText:     nextWeather.Rain.RainText(),
-		SunsetTime:         weatherForecast.SunsetLocalTime(),
-	}
-
-	return weatherSummary, nil
+		CurrentTemperature:  int64(math.Round(currentWeather.Main.Temp)),
+		FutureTemperature:   int64(math.Round(nextWeather.Main.Temp)),
+		CurrentWindSpeed:    int64(math.Round(currentWeather.Wind.Speed * 3.6)),
+		FutureWindSpeed:     int64(math.Round(nextWeather.Wind.Speed * 3.6)),
+		CurrentWindGust:     int64(math.Round(currentWeather.Wind.Gust * 3.6)),
+		FutureWindGust:      int64(math.Round(nextWeather.Wind.Gust * 3.6)),
+		CurrentWindDegrees:  currentWeather.Wind.Deg,
+		FutureWindDegrees:   nextWeather.Wind.Deg,
+		CurrentWindScale:    currentWeather.Wind.Scale(),
+		FutureWindScale:     nextWeather.Wind.Scale(),
+		CurrentBeaufort:     currentWeather.Wind.Beaufort(),
+		FutureBeaufort:      nextWeather.Wind.Beaufort(),
+		CurrentBeaufortText: locale.Default.BeaufortText(currentWeather.Wind.Beaufort()),
+		FutureBeaufortText:  locale.Default.BeaufortText(nextWeather.Wind.Beaufort()),
+		CurrentRain:         currentWeather.Rain.RainIntensity(),
+		FutureRain:          nextWeather.Rain.RainIntensity(),
+		CurrentRainText:     currentWeather.Rain.RainText(),
+		FutureRainText:      nextWeather.Rain.RainText(),
+		Source:              source,
+		Units:               locale.Default.Labels(),
+	}
+
+	for _, entry := range weatherForecast.List {
+		weatherSummary.Forecast = append(weatherSummary.Forecast, models.NewForecastBlock(entry))
+	}
+
+	// Not every provider reports the sunset
+	if weatherForecast.City.Sunset != 0 {
+		weatherSummary.Sunset = time.Unix(weatherForecast.City.Sunset, 0)
+	}
+
+	// Standing still, the handlers apply the speed of the rider
+	return weatherSummary.WithRiderSpeed(0), nil
+}
+
+// Weather provider registry
+//
+// Providers are selected by name in the configuration. Each factory receives
+// the full provider configuration and picks the settings it needs.
+type WeatherProviderConfig struct {
+	OwmApiKey string
+	// Length of the forecast, that is requested from the providers
+	ForecastHours int64
+	// Sent with every request, MET Norway rejects requests without an
+	// identifying User-Agent.
+	UserAgent string
+}
+
+type weatherProviderFactory func(config WeatherProviderConfig) (WeatherService, error)
+
+var weatherProviders = map[string]weatherProviderFactory{
+	"openweathermap": func(config WeatherProviderConfig) (WeatherService, error) {
+		if config.OwmApiKey == "" {
+			return nil, errors.New("openweathermap requires an API key")
+		}
+		return NewOpenWeatherService(config.OwmApiKey, config.ForecastHours), nil
+	},
+	"open-meteo": func(config WeatherProviderConfig) (WeatherService, error) {
+		return NewOpenMeteoService(config.ForecastHours), nil
+	},
+	"brightsky": func(config WeatherProviderConfig) (WeatherService, error) {
+		return NewBrightSkyService(config.ForecastHours), nil
+	},
+	"metno": func(config WeatherProviderConfig) (WeatherService, error) {
+		if config.UserAgent == "" {
+			return nil, errors.New("metno requires a User-Agent")
+		}
+		return NewMetNorwayService(config.UserAgent, config.ForecastHours), nil
+	},
+}
+
+// Returns the names of all available weather providers in alphabetical order.
+func WeatherProviders() []string {
+	return slices.Sorted(maps.Keys(weatherProviders))
+}
+
+// Creates the weather service registered under the given provider name.
+func NewWeatherService(provider string, config WeatherProviderConfig) (WeatherService, error) {
+	factory, ok := weatherProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown weather provider %q, available providers: %s",
+			provider,
+			strings.Join(WeatherProviders(), ", "))
+	}
+
+	return factory(config)
+}
+
+// Hourly forecast values in a provider independent format. Providers with an
+// hourly resolution collect these and aggregate them into 3-hour blocks.
+type hourlyForecast struct {
+	timestamp     int64
+	temp          float64
+	humidity      float64
+	windSpeed     float64 // in m/s
+	windDeg       float64
+	windGust      float64 // in m/s
+	precipitation float64 // in mm
+	pop           float64 // from 0 to 1
+	clouds        float64 // in percent
+	// Weather condition as OpenWeatherMap condition id, 0 if unknown
+	condition int64
+}
+
+// Returns the condition that matters more for riders. Thunderstorms (2xx)
+// take precedence, otherwise the first known condition is kept.
+func moreSevereCondition(current int64, next int64) int64 {
+	if current == 0 || (next/100 == 2 && current/100 != 2) {
+		return next
+	}
+	return current
+}
+
+// Aggregates hourly values into blocks of the given interval, starting with
+// the block that contains the current hour. Instantaneous values are taken
+// from the first hour of a block, precipitation is summed up, gusts and
+// probability of precipitation are the maximum within a block. The condition
+// is the most severe one within the block.
+func aggregateHourlyForecast(hours []hourlyForecast, now time.Time, interval int) []models.ForecastEntry {
+	currentHour := now.Truncate(time.Hour).Unix()
+
+	start := 0
+	for start < len(hours) && hours[start].timestamp < currentHour {
+		start++
+	}
+
+	var entries []models.ForecastEntry
+
+	for i := start; i < len(hours); i += interval {
+		block := hours[i:min(i+interval, len(hours))]
+		first := block[0]
+
+		entry := models.ForecastEntry{
+			Timestamp: first.timestamp,
+			Main: models.Main{
+				Temp:     first.temp,
+				Humidity: int64(math.Round(first.humidity)),
+			},
+			Clouds: models.Clouds{All: int64(math.Round(first.clouds))},
+			Wind: models.Wind{
+				Speed: first.windSpeed,
+				Deg:   int64(math.Round(first.windDeg)),
+			},
+			TimestampText: time.Unix(first.timestamp, 0).UTC().Format(time.DateTime),
+		}
+
+		var condition int64
+
+		for _, hour := range block {
+			entry.Rain.ThreeHours += hour.precipitation
+			entry.Wind.Gust = max(entry.Wind.Gust, hour.windGust)
+			entry.Pop = max(entry.Pop, hour.pop)
+			condition = moreSevereCondition(condition, hour.condition)
+		}
+
+		if condition != 0 {
+			entry.Weather = []models.Weather{{Id: condition}}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Sends a GET request and decodes the JSON response into target. Responses
+// with a status other than 200 are treated as errors.
+func getJSON(requestUrl string, userAgent string, target any) error {
+	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, req.URL.Host)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
 }
 
 // Overpass
 type overpassElement struct {
 	OverpassType string  `json:"type"`
+	ID           int64   `json:"id"`
 	Lon          float64 `json:"lon"`
 	Lat          float64 `json:"lat"`
 	Bounds       struct {
 		MinLat float64 `json:"minlat"`
-		MinLon float64 `json:"minLon"`
-		MaxLat float64 `json:"maxLat"`
-		MaxLon float64 `json:"maxLon"`
+		MinLon float64 `json:"minlon"`
+		MaxLat float64 `json:"maxlat"`
+		MaxLon float64 `json:"maxlon"`
 	} `json:"bounds"`
-	Tags struct {
-		Name        string `json:"name"`
-		Website     string `json:"website"`
-		Street      string `json:"addr:street"`
-		Housenumber string `json:"addr:housenumber"`
-		Postcode    string `json:"addr:postcode"`
-		City        string `json:"addr:city"`
-	} `json:"tags"`
+	Tags map[string]string `json:"tags"`
+	// Geometry of ways and members of relations, as returned by `out geom`
+	Nodes    []int64          `json:"nodes,omitempty"`
+	Geometry []overpassPoint  `json:"geometry,omitempty"`
+	Members  []overpassMember `json:"members,omitempty"`
+	// Node of a way, that is tagged as entrance, only for categories with
+	// entrances
+	Entrance *overpassPoint `json:"entrance,omitempty"`
+}
+
+type overpassPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (p overpassPoint) location() models.Location {
+	return models.Location{Lon: models.Coordinate(p.Lon), Lat: models.Coordinate(p.Lat)}
+}
+
+type overpassMember struct {
+	Type     string          `json:"type"`
+	Ref      int64           `json:"ref"`
+	Role     string          `json:"role"`
+	Lon      float64         `json:"lon,omitempty"`
+	Lat      float64         `json:"lat,omitempty"`
+	Geometry []overpassPoint `json:"geometry,omitempty"`
 }
 
 func (e *overpassElement) GetAddress() string {
-	if e.Tags.City == "" {
+	if e.Tags["addr:city"] == "" {
 		return ""
 	}
 
 	var addressParts []string
 
-	if e.Tags.Street != "" {
-		street := e.Tags.Street
-		if e.Tags.Housenumber != "" {
-			street = strings.Join([]string{street, e.Tags.Housenumber}, " ")
+	if e.Tags["addr:street"] != "" {
+		street := e.Tags["addr:street"]
+		if e.Tags["addr:housenumber"] != "" {
+			street = strings.Join([]string{street, e.Tags["addr:housenumber"]}, " ")
 		}
 
 		street += ","
 		addressParts = append(addressParts, street)
 	}
 
-	if e.Tags.Postcode != "" {
-		addressParts = append(addressParts, e.Tags.Postcode)
+	if e.Tags["addr:postcode"] != "" {
+		addressParts = append(addressParts, e.Tags["addr:postcode"])
 	}
 
-	addressParts = append(addressParts, e.Tags.City)
+	addressParts = append(addressParts, e.Tags["addr:city"])
 
 	return strings.Join(addressParts, " ")
 }
 
+// Returns the lines of a way or the joined lines of the member ways of a
+// relation, split into outer and inner lines.
+func (e *overpassElement) lines() (outer [][]models.Location, inner [][]models.Location) {
+	toLine := func(points []overpassPoint) []models.Location {
+		line := make([]models.Location, len(points))
+		for i, point := range points {
+			line[i] = point.location()
+		}
+		return line
+	}
+
+	switch e.OverpassType {
+	case "way":
+		if len(e.Geometry) > 0 {
+			outer = append(outer, toLine(e.Geometry))
+		}
+	case "relation":
+		for _, member := range e.Members {
+			if member.Type != "way" || len(member.Geometry) == 0 {
+				continue
+			}
+			if member.Role == "inner" {
+				inner = append(inner, toLine(member.Geometry))
+			} else {
+				outer = append(outer, toLine(member.Geometry))
+			}
+		}
+		outer, inner = models.JoinLines(outer), models.JoinLines(inner)
+	}
+
+	return outer, inner
+}
+
+// Position of the element, where it is shown. Ways and relations are placed
+// at the centroid of their area, lines and elements without geometry at the
+// center of their bounding box.
+func (e *overpassElement) location() models.Location {
+	switch e.OverpassType {
+	case "way", "relation":
+		outer, inner := e.lines()
+
+		var rings [][]models.Location
+		for _, line := range outer {
+			if models.IsRing(line) {
+				rings = append(rings, line)
+			}
+		}
+		if centroid, ok := models.Centroid(rings, inner); ok {
+			return centroid
+		}
+
+		return models.Location{
+			Lon: models.Coordinate((e.Bounds.MinLon + e.Bounds.MaxLon) / 2),
+			Lat: models.Coordinate((e.Bounds.MinLat + e.Bounds.MaxLat) / 2),
+		}
+	default:
+		return models.Location{Lon: models.Coordinate(e.Lon), Lat: models.Coordinate(e.Lat)}
+	}
+}
+
+// Position, where the element can be entered from the given location: the
+// entrance if there is one, otherwise the nearest point of the outline of ways
+// and relations.
+func (e *overpassElement) access(from models.Location) models.Location {
+	if e.Entrance != nil {
+		return e.Entrance.location()
+	}
+
+	outer, _ := e.lines()
+	if nearest, ok := models.NearestPoint(from, outer); ok {
+		return nearest
+	}
+
+	return e.location()
+}
+
 type overpassResult struct {
 	Elements []overpassElement `json:"elements"`
+	// Overpass reports runtime errors like timeouts here, while still
+	// answering with status 200 and incomplete elements.
+	Remark string `json:"remark"`
 }
 
 type PoiService interface {
-	GetCampingPois(lon float64, lat float64) (models.OverpassSites, error)
-	GetDrinkingWaterPois(lon float64, lat float64) (models.OverpassSites, error)
-	GetCafePois(lon float64, lat float64) (models.OverpassSites, error)
-	GetObservationPois(lon float64, lat float64) (models.OverpassSites, error)
+	// Returns the POIs within the radius (in km), which is limited to the
+	// maximum distance of the service and defaults to it, if it is 0
+	GetPois(category string, lon float64, lat float64, radius float64) (models.OverpassSites, error)
+	// Returns the POIs of several categories by category, like GetPois
+	GetPoisByCategory(categories []string, lon float64, lat float64, radius float64) (map[string]models.OverpassSites, error)
+	// Returns ErrPoiNotFound, if there is no such element
+	GetPoiDetails(osmType string, id int64) (models.PoiDetails, error)
+	// Returns the POIs within the corridor (in km) around the route, that are
+	// ahead of the position, sorted by their distance along the route
+	GetPoisAlongRoute(category string, route models.Route, corridor float64, position models.Location) (models.OverpassSites, error)
 }
 
 type overpassPoiService struct {
 	url         string
+	categories  PoiCategories
 	maxDistance int64
+	// Optional, if set, elements are looked up in the cache first
+	cache *poiTileCache
 }
 
-func NewOverpassPoiService(maxDistance int64) PoiService {
+func NewOverpassPoiService(categories PoiCategories, maxDistance int64, cache *poiTileCache) PoiService {
 	return &overpassPoiService{
 		url:         "https://overpass-api.de/api/interpreter",
+		categories:  categories,
 		maxDistance: maxDistance,
+		cache:       cache,
 	}
 }
 
@@ -160,121 +450,281 @@ func (s *overpassPoiService) query(query string) (*overpassResult, error) {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from overpass", resp.Status)
+	}
+
 	var overpassResult = overpassResult{}
 	if err := json.NewDecoder(resp.Body).Decode(&overpassResult); err != nil {
 		log.Println("Error unmarshalling overpass result:", err)
 		return nil, err
 	}
 
+	if strings.Contains(overpassResult.Remark, "error") {
+		return nil, fmt.Errorf("overpass query failed: %s", overpassResult.Remark)
+	}
+
 	return &overpassResult, nil
 }
 
-func (s *overpassPoiService) convertOverpassResults(pois *overpassResult, lon float64, lat float64) models.OverpassSites {
-	sites := models.OverpassSites{}
+// Fetches all elements of the categories within the radius, by category.
+// Overpass is asked with a single query for the union of the categories. With
+// a cache, only tiles that are not cached yet are requested, by a single query
+// for their bounding box and the categories that miss them.
+func (s *overpassPoiService) fetchElements(categories PoiCategories, lon float64, lat float64, radius float64) (map[string][]overpassElement, error) {
+	if s.cache == nil {
+		result, err := s.query(categories.overpassQuery(fmt.Sprintf("around:%.0f,%v,%v", radius*1000, lat, lon)))
+		if err != nil {
+			return nil, err
+		}
+		return categories.split(result.Elements), nil
+	}
 
-	for _, element := range pois.Elements {
-		var siteLon, siteLat models.Coordinate
-		switch element.OverpassType {
-		case "node":
-			siteLon = models.Coordinate(element.Lon)
-			siteLat = models.Coordinate(element.Lat)
-		case "way", "relation":
-			siteLon = models.Coordinate((element.Bounds.MinLon + element.Bounds.MaxLon) / 2)
-			siteLat = models.Coordinate((element.Bounds.MinLat + element.Bounds.MaxLat) / 2)
+	return s.fetchTiles(categories, s.cache.tilesAround(lon, lat, radius))
+}
+
+// Fetches all elements of the categories within the tiles from the cache.
+// Missing tiles are requested for the bounding boxes of groups of neighboring
+// tiles, with a single query per group for the categories that miss them.
+func (s *overpassPoiService) fetchTiles(categories PoiCategories, tiles []poiTileKey) (map[string][]overpassElement, error) {
+	elements := map[string][]overpassElement{}
+	var missingCategories PoiCategories
+	var missingTiles []poiTileKey
+	missingFound := map[poiTileKey]bool{}
+
+	for _, category := range categories {
+		cached, missing := s.cache.lookup(category, tiles)
+		if len(missing) == 0 {
+			elements[category.Name] = cached
+			continue
+		}
+		missingCategories = append(missingCategories, category)
+		for _, tile := range missing {
+			if !missingFound[tile] {
+				missingFound[tile] = true
+				missingTiles = append(missingTiles, tile)
+			}
 		}
+	}
 
-		site := models.NewSite(models.Location{Lon: siteLon, Lat: siteLat}, models.Location{Lon: models.Coordinate(lon), Lat: models.Coordinate(lat)}, s.maxDistance)
+	if len(missingCategories) == 0 {
+		return elements, nil
+	}
 
-		// TODO: add properties to filtered POIs instead of all overpass results
-		site.Name = element.Tags.Name
-		site.Website = element.Tags.Website
-		site.Address = element.GetAddress()
+	for _, group := range s.cache.group(missingTiles, maxPoiQueryTiles) {
+		queriedTiles, south, west, north, east := s.cache.bounds(group)
 
-		sites = append(sites, site)
+		result, err := s.query(missingCategories.overpassQuery(fmt.Sprintf("%v,%v,%v,%v", south, west, north, east)))
+		if err != nil {
+			return nil, err
+		}
+
+		split := missingCategories.split(result.Elements)
+		for _, category := range missingCategories {
+			s.cache.store(category, queriedTiles, split[category.Name])
+		}
 	}
 
-	return sites
+	for _, category := range missingCategories {
+		elements[category.Name], _ = s.cache.collect(category, tiles)
+	}
+
+	return elements, nil
 }
 
-func (s *overpassPoiService) GetCampingPois(lon float64, lat float64) (models.OverpassSites, error) {
-	query := fmt.Sprintf(`[out:json];nwr["tourism"="camp_site"]["tent"!="no"](around:%d,%v,%v);out geom;`,
-		s.maxDistance*1000,
-		lat,
-		lon)
+func (s *overpassPoiService) GetPois(categoryName string, lon float64, lat float64, radius float64) (models.OverpassSites, error) {
+	category, ok := s.categories.Get(categoryName)
+	if !ok {
+		return nil, ErrUnknownCategory
+	}
 
-	foundPois, err := s.query(query)
+	radius = searchRadius(radius, s.maxDistance)
+	foundPois, err := s.fetchElements(PoiCategories{category}, lon, lat, radius)
 
 	if err != nil {
-		log.Println("Could not fetch campsites")
+		log.Printf("Could not fetch %s POIs", category.Name)
 		return nil, err
 	}
 
-	pois := s.convertOverpassResults(foundPois, lon, lat)
-	pois.SortByDistance()
-	pois.FilterByBearing()
-
-	return pois, nil
+	return newPoiSites(foundPois[category.Name], category, lon, lat, radius), nil
 }
 
-func (s *overpassPoiService) GetDrinkingWaterPois(lon float64, lat float64) (models.OverpassSites, error) {
-	query := fmt.Sprintf(`[out:json];(nwr["amenity"="drinking_water"]["access"!="permissive"]["access"!="private"](around:%d,%v,%v);nwr["drinking_water"="yes"]["access"!="permissive"]["access"!="private"](around:%d,%v,%v);nwr["disused:amenity"="drinking_water"]["access"!="permissive"]["access"!="private"](around:%d,%v,%v););out geom;`,
-		s.maxDistance*1000, lat, lon,
-		s.maxDistance*1000, lat, lon,
-		s.maxDistance*1000, lat, lon)
+func (s *overpassPoiService) GetPoisByCategory(categoryNames []string, lon float64, lat float64, radius float64) (map[string]models.OverpassSites, error) {
+	categories, err := s.categories.subset(categoryNames)
+	if err != nil {
+		return nil, err
+	}
 
-	foundPois, err := s.query(query)
+	radius = searchRadius(radius, s.maxDistance)
+	foundPois, err := s.fetchElements(categories, lon, lat, radius)
 
 	if err != nil {
-		log.Println("Could not fetch drinking water")
+		log.Printf("Could not fetch POIs of %d categories", len(categories))
 		return nil, err
 	}
 
-	pois := s.convertOverpassResults(foundPois, lon, lat)
-	pois.SortByDistance()
-	pois.FilterByBearing()
+	sites := map[string]models.OverpassSites{}
+	for _, category := range categories {
+		sites[category.Name] = newPoiSites(foundPois[category.Name], category, lon, lat, radius)
+	}
 
-	return pois, nil
+	return sites, nil
 }
 
-func (s *overpassPoiService) GetCafePois(lon float64, lat float64) (models.OverpassSites, error) {
-	query := fmt.Sprintf(`[out:json];nwr["amenity"="cafe"](around:%d,%v,%v);out geom;`,
-		s.maxDistance*1000,
-		lat,
-		lon)
+// Searches the corridor in the tiles along the route with a cache, otherwise
+// with a single query for the simplified route, as Overpass accepts a line for
+// the around filter.
+func (s *overpassPoiService) GetPoisAlongRoute(categoryName string, route models.Route, corridor float64, position models.Location) (models.OverpassSites, error) {
+	category, ok := s.categories.Get(categoryName)
+	if !ok {
+		return nil, ErrUnknownCategory
+	}
 
-	foundPois, err := s.query(query)
+	route = route.Simplify(routeTolerance)
 
+	if s.cache != nil {
+		foundPois, err := s.fetchTiles(PoiCategories{category}, s.cache.tilesAlong(route, corridor))
+		if err != nil {
+			log.Printf("Could not fetch %s POIs along route", category.Name)
+			return nil, err
+		}
+		return newRouteSites(foundPois[category.Name], category, route, corridor, position), nil
+	}
+
+	// Long routes are simplified further for the query, step by step, and the
+	// corridor is widened by the additional deviation of each step
+	line, lineCorridor := route, corridor
+	for tolerance := 2 * routeTolerance; len(line) > maxRouteQueryPoints; tolerance *= 2 {
+		line, lineCorridor = line.Simplify(tolerance), lineCorridor+tolerance
+	}
+
+	area := fmt.Sprintf("around:%.0f", lineCorridor*1000)
+	for _, location := range line {
+		area += fmt.Sprintf(",%v,%v", location.Lat, location.Lon)
+	}
+
+	result, err := s.query(category.overpassQuery(area))
 	if err != nil {
-		log.Println("Could not fetch cafes")
+		log.Printf("Could not fetch %s POIs along route", category.Name)
 		return nil, err
 	}
 
-	pois := s.convertOverpassResults(foundPois, lon, lat)
-	pois.SortByDistance()
-	pois.FilterByBearing()
+	return newRouteSites(category.attachEntrances(result.Elements), category, route, corridor, position), nil
+}
+
+func (s *overpassPoiService) GetPoiDetails(osmType string, id int64) (models.PoiDetails, error) {
+	if !ValidOsmType(osmType) {
+		return models.PoiDetails{}, ErrPoiNotFound
+	}
+
+	result, err := s.query(fmt.Sprintf("[out:json];%s(%d);out geom;", osmType, id))
+	if err != nil {
+		log.Printf("Could not fetch details of %s %d", osmType, id)
+		return models.PoiDetails{}, err
+	}
+
+	if len(result.Elements) == 0 {
+		return models.PoiDetails{}, ErrPoiNotFound
+	}
 
-	return pois, nil
+	return newPoiDetails(result.Elements[0]), nil
 }
 
-func (s *overpassPoiService) GetObservationPois(lon float64, lat float64) (models.OverpassSites, error) {
-	query := fmt.Sprintf(`[out:json];(nwr["man_made"="tower"]["tower:type"="observation"](around:%d,%v,%v);nwr["leisure"="bird_hide"](around:%d,%v,%v););out geom;`,
-		s.maxDistance*1000,
-		lat,
-		lon,
-		s.maxDistance*1000,
-		lat,
-		lon)
+// Returns the radius (in km) of a search, limited to the maximum distance.
+func searchRadius(radius float64, maxDistance int64) float64 {
+	if radius <= 0 {
+		return float64(maxDistance)
+	}
+	return min(radius, float64(maxDistance))
+}
 
-	foundPois, err := s.query(query)
+// Converts the elements into sites relative to the given location. Sites
+// farther away than the radius are dropped, the remaining ones are sorted by
+// distance.
+func newPoiSites(elements []overpassElement, category PoiCategory, lon float64, lat float64, radius float64) models.OverpassSites {
+	sites := models.OverpassSites{}
 
-	if err != nil {
-		log.Println("Could not fetch observation sites")
-		return nil, err
+	for _, element := range elements {
+		reference := models.Location{Lon: models.Coordinate(lon), Lat: models.Coordinate(lat)}
+		site := models.NewSite(element.location(), reference, radius)
+
+		// Cached tiles and offline indexes cover more than the search radius
+		if site.Distance > radius {
+			continue
+		}
+
+		site.SetAccess(element.access(reference))
+
+		// TODO: add properties to filtered POIs instead of all overpass results
+		site.OsmType = element.OverpassType
+		site.OsmId = element.ID
+		site.Name = element.Tags["name"]
+		site.Website = element.Tags["website"]
+		site.Address = element.GetAddress()
+		site.OpeningHours = element.Tags["opening_hours"]
+		site.Tags = category.exposedTags(element.Tags)
+
+		sites = append(sites, site)
+	}
+
+	sites.SortByDistance()
+
+	return sites
+}
+
+// Tolerance (in km) of simplifying routes, before searching along them. Long
+// GPX tracks have a point every few meters, which is not needed for the search.
+const routeTolerance = 0.05
+
+// Maximum number of points of the line of a single Overpass query along a
+// route
+const maxRouteQueryPoints = 1000
+
+// Converts the elements into sites along the route. Sites outside the corridor
+// or behind the position are dropped, the remaining ones are sorted by their
+// distance along the route, counted from the position.
+func newRouteSites(elements []overpassElement, category PoiCategory, route models.Route, corridor float64, position models.Location) models.OverpassSites {
+	sites := models.OverpassSites{}
+
+	positionAlong, _ := route.Project(position)
+	remaining := max(route.Length()-positionAlong, 1)
+
+	for _, element := range elements {
+		location := element.location()
+
+		along, offset := route.Project(location)
+		if offset > corridor || along < positionAlong {
+			continue
+		}
+
+		site := models.NewSite(location, position, remaining)
+		site.SetRoutePosition(along-positionAlong, offset)
+		// Entered from where the route passes closest
+		if routePoint, ok := models.NearestPoint(location, [][]models.Location{route}); ok {
+			site.SetAccess(element.access(routePoint))
+		}
+		site.OsmType = element.OverpassType
+		site.OsmId = element.ID
+		site.Name = element.Tags["name"]
+		site.Website = element.Tags["website"]
+		site.Address = element.GetAddress()
+		site.OpeningHours = element.Tags["opening_hours"]
+		site.Tags = category.exposedTags(element.Tags)
+
+		sites = append(sites, site)
 	}
 
-	pois := s.convertOverpassResults(foundPois, lon, lat)
-	pois.SortByDistance()
-	pois.FilterByBearing()
+	sites.SortByRouteDistance()
+
+	return sites
+}
+
+// Returns the bounding box of a circle around the location, with the radius in
+// km.
+func boundingBox(lon float64, lat float64, radius float64) (south, west, north, east float64) {
+	kmPerDegree := 111.2
+	deltaLat := radius / kmPerDegree
+	deltaLon := radius / (kmPerDegree * max(math.Cos(lat/180*math.Pi), 0.01))
 
-	return pois, nil
+	return max(lat-deltaLat, -90), lon - deltaLon, min(lat+deltaLat, 90), lon + deltaLon
 }
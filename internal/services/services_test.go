@@ -0,0 +1,1270 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+// Serves the given payload as JSON and records the last request.
+func newFakeServer(t *testing.T, payload any, lastRequest **http.Request) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lastRequest != nil {
+			*lastRequest = r
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(payload)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestWeatherProviders(t *testing.T) {
+	currentHour := time.Now().UTC().Truncate(time.Hour)
+
+	// Six hours of weather, the second 3-hour block is windier and wet
+	hourTimes := make([]time.Time, 6)
+	for i := range hourTimes {
+		hourTimes[i] = currentHour.Add(time.Duration(i) * time.Hour)
+	}
+
+	expected := models.WeatherSummary{
+		CurrentTemperature: 12,
+		FutureTemperature:  15,
+		CurrentWindSpeed:   18,
+		FutureWindSpeed:    36,
+		CurrentWindGust:    36,
+		FutureWindGust:     54,
+		CurrentWindDegrees: 270,
+		FutureWindDegrees:  180,
+		CurrentRain:        0,
+		FutureRain:         3,
+		CurrentRainText:    "dry",
+		FutureRainText:     "heavy",
+	}
+
+	checkSummary := func(t *testing.T, actual models.WeatherSummary) {
+		t.Helper()
+
+		if actual.CurrentTemperature != expected.CurrentTemperature || actual.FutureTemperature != expected.FutureTemperature {
+			t.Errorf("expected temperatures %d/%d, but got %d/%d", expected.CurrentTemperature, expected.FutureTemperature, actual.CurrentTemperature, actual.FutureTemperature)
+		}
+		if actual.CurrentWindSpeed != expected.CurrentWindSpeed || actual.FutureWindSpeed != expected.FutureWindSpeed {
+			t.Errorf("expected wind speeds %d/%d, but got %d/%d", expected.CurrentWindSpeed, expected.FutureWindSpeed, actual.CurrentWindSpeed, actual.FutureWindSpeed)
+		}
+		if actual.CurrentWindGust != expected.CurrentWindGust || actual.FutureWindGust != expected.FutureWindGust {
+			t.Errorf("expected gusts %d/%d, but got %d/%d", expected.CurrentWindGust, expected.FutureWindGust, actual.CurrentWindGust, actual.FutureWindGust)
+		}
+		if actual.CurrentWindDegrees != expected.CurrentWindDegrees || actual.FutureWindDegrees != expected.FutureWindDegrees {
+			t.Errorf("expected wind directions %d/%d, but got %d/%d", expected.CurrentWindDegrees, expected.FutureWindDegrees, actual.CurrentWindDegrees, actual.FutureWindDegrees)
+		}
+		if actual.CurrentRainText != expected.CurrentRainText || actual.FutureRainText != expected.FutureRainText {
+			t.Errorf("expected rain %q/%q, but got %q/%q", expected.CurrentRainText, expected.FutureRainText, actual.CurrentRainText, actual.FutureRainText)
+		}
+		if len(actual.Forecast) != 2 || actual.Forecast[1].Rain != 3.5 || actual.Forecast[1].WindSpeed != 36 {
+			t.Errorf("expected 2 forecast blocks with the rain and wind of the second one, but got %+v", actual.Forecast)
+		}
+	}
+
+	// Hourly values in SI units, indexed by hour
+	temperature := []float64{12, 12, 13, 15, 15, 14}
+	windSpeed := []float64{5, 5, 6, 10, 10, 9}
+	windDirection := []float64{270, 270, 260, 180, 180, 190}
+	windGust := []float64{10, 8, 9, 15, 14, 12}
+	precipitation := []float64{0, 0, 0, 1, 2, 0.5}
+
+	t.Run("openweathermap", func(t *testing.T) {
+		payload := map[string]any{
+			"list": []map[string]any{
+				{
+					"dt":   hourTimes[0].Unix(),
+					"main": map[string]any{"temp": 12.2},
+					"wind": map[string]any{"speed": 5, "deg": 270, "gust": 10},
+				},
+				{
+					"dt":   hourTimes[3].Unix(),
+					"main": map[string]any{"temp": 14.8},
+					"wind": map[string]any{"speed": 10, "deg": 180, "gust": 15},
+					"rain": map[string]any{"3h": 3.5},
+				},
+			},
+			"city": map[string]any{"timezone": 3600, "sunset": hourTimes[5].Unix()},
+		}
+
+		var request *http.Request
+		server := newFakeServer(t, payload, &request)
+
+		service := NewOpenWeatherService("secret", 48).(*openWeatherService)
+		service.forecastUrl = server.URL
+
+		summary, err := service.GetWeatherForecast(13.4, 52.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if request.URL.Query().Get("appid") != "secret" {
+			t.Errorf("expected API key to be sent")
+		}
+		if summary.Sunset.IsZero() {
+			t.Errorf("expected sunset time")
+		}
+		checkSummary(t, summary)
+	})
+
+	t.Run("open-meteo", func(t *testing.T) {
+		timestamps := make([]int64, len(hourTimes))
+		for i, hourTime := range hourTimes {
+			timestamps[i] = hourTime.Unix()
+		}
+
+		payload := map[string]any{
+			"utc_offset_seconds": 7200,
+			"hourly": map[string]any{
+				"time":                      timestamps,
+				"temperature_2m":            temperature,
+				"precipitation":             precipitation,
+				"precipitation_probability": []float64{0, 0, 10, 80, 90, 40},
+				"wind_speed_10m":            windSpeed,
+				"wind_direction_10m":        windDirection,
+				"wind_gusts_10m":            windGust,
+			},
+			"daily": map[string]any{
+				"sunset": []int64{hourTimes[5].Unix()},
+			},
+		}
+
+		var request *http.Request
+		server := newFakeServer(t, payload, &request)
+
+		service := NewOpenMeteoService(48).(*openMeteoService)
+		service.forecastUrl = server.URL
+
+		summary, err := service.GetWeatherForecast(13.4, 52.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if request.URL.Query().Get("wind_speed_unit") != "ms" {
+			t.Errorf("expected wind speed to be requested in m/s")
+		}
+		if summary.Sunset.IsZero() {
+			t.Errorf("expected sunset time")
+		}
+		checkSummary(t, summary)
+	})
+
+	t.Run("brightsky", func(t *testing.T) {
+		var records []map[string]any
+		for i, hourTime := range hourTimes {
+			records = append(records, map[string]any{
+				"timestamp":       hourTime.Format(time.RFC3339),
+				"temperature":     temperature[i],
+				"precipitation":   precipitation[i],
+				"wind_speed":      windSpeed[i] * 3.6,
+				"wind_direction":  windDirection[i],
+				"wind_gust_speed": windGust[i] * 3.6,
+				"cloud_cover":     nil,
+			})
+		}
+
+		server := newFakeServer(t, map[string]any{"weather": records}, nil)
+
+		service := NewBrightSkyService(48).(*brightSkyService)
+		service.weatherUrl = server.URL
+
+		summary, err := service.GetWeatherForecast(13.4, 52.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkSummary(t, summary)
+	})
+
+	t.Run("metno", func(t *testing.T) {
+		var timeseries []map[string]any
+		for i, hourTime := range hourTimes {
+			timeseries = append(timeseries, map[string]any{
+				"time": hourTime.Format(time.RFC3339),
+				"data": map[string]any{
+					"instant": map[string]any{"details": map[string]any{
+						"air_temperature":     temperature[i],
+						"wind_speed":          windSpeed[i],
+						"wind_from_direction": windDirection[i],
+						"wind_speed_of_gust":  windGust[i],
+					}},
+					"next_1_hours": map[string]any{"details": map[string]any{
+						"precipitation_amount": precipitation[i],
+					}},
+				},
+			})
+		}
+
+		var request *http.Request
+		server := newFakeServer(t, map[string]any{"properties": map[string]any{"timeseries": timeseries}}, &request)
+
+		service := NewMetNorwayService("rueckenwind-test", 48).(*metNorwayService)
+		service.forecastUrl = server.URL
+
+		summary, err := service.GetWeatherForecast(13.123456, 52.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if request.UserAgent() != "rueckenwind-test" {
+			t.Errorf("expected User-Agent to be sent, got %q", request.UserAgent())
+		}
+		if request.URL.Query().Get("lon") != "13.1235" {
+			t.Errorf("expected coordinates with four decimals, got %q", request.URL.Query().Get("lon"))
+		}
+		checkSummary(t, summary)
+	})
+
+	t.Run("metno 6-hour entries", func(t *testing.T) {
+		entry := func(hourTime time.Time, period string, precipitation float64) map[string]any {
+			return map[string]any{
+				"time": hourTime.Format(time.RFC3339),
+				"data": map[string]any{
+					"instant": map[string]any{"details": map[string]any{"air_temperature": 10}},
+					period:    map[string]any{"details": map[string]any{"precipitation_amount": precipitation}},
+				},
+			}
+		}
+
+		timeseries := []map[string]any{
+			entry(hourTimes[0], "next_1_hours", 0),
+			entry(hourTimes[1], "next_1_hours", 0),
+			entry(hourTimes[2], "next_1_hours", 0),
+			entry(hourTimes[3], "next_6_hours", 6),
+			// Beyond the forecast hours
+			entry(hourTimes[3].Add(6*time.Hour), "next_6_hours", 6),
+		}
+
+		server := newFakeServer(t, map[string]any{"properties": map[string]any{"timeseries": timeseries}}, nil)
+
+		service := NewMetNorwayService("rueckenwind-test", 9).(*metNorwayService)
+		service.forecastUrl = server.URL
+
+		summary, err := service.GetWeatherForecast(13.4, 52.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(summary.Forecast) != 3 || summary.Forecast[1].Rain != 3 || summary.Forecast[2].Rain != 3 {
+			t.Errorf("expected 3 forecast blocks with the 6-hour rain spread over the last two, but got %+v", summary.Forecast)
+		}
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		service := NewOpenMeteoService(48).(*openMeteoService)
+		service.forecastUrl = server.URL
+
+		if _, err := service.GetWeatherForecast(13.4, 52.5); err == nil {
+			t.Fatal("expected error for non-200 response")
+		}
+	})
+}
+
+func TestWeatherConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition int64
+		expected  int64
+	}{
+		{"open-meteo thunderstorm", wmoCondition(95), 211},
+		{"open-meteo thunderstorm with hail", wmoCondition(99), 202},
+		{"open-meteo drizzle", wmoCondition(53), 300},
+		{"open-meteo unknown", wmoCondition(42), 0},
+		{"brightsky thunderstorm", brightSkyCondition(func() *string { s := "thunderstorm"; return &s }()), 211},
+		{"brightsky hail", brightSkyCondition(func() *string { s := "hail"; return &s }()), 611},
+		{"brightsky missing", brightSkyCondition(nil), 0},
+		{"metno thunder", metNorwayCondition("heavyrainshowersandthunder_day"), 211},
+		{"metno light rain", metNorwayCondition("lightrain"), 500},
+		{"metno clear sky", metNorwayCondition("clearsky_night"), 800},
+	}
+
+	for _, test := range tests {
+		if test.condition != test.expected {
+			t.Errorf("%s: expected %d, but got %d", test.name, test.expected, test.condition)
+		}
+	}
+
+	// A thunderstorm within a block is more important than its first hour
+	now := time.Now().Truncate(time.Hour)
+	hours := []hourlyForecast{
+		{timestamp: now.Unix(), condition: 500},
+		{timestamp: now.Add(time.Hour).Unix(), condition: 211},
+		{timestamp: now.Add(2 * time.Hour).Unix(), condition: 800},
+	}
+	entries := aggregateHourlyForecast(hours, now, 3)
+	if len(entries) != 1 || entries[0].Weather[0].Id != 211 {
+		t.Errorf("expected thunderstorm condition for the block, but got %+v", entries)
+	}
+}
+
+func TestBrightSkyAlertService(t *testing.T) {
+	onset := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	payload := map[string]any{
+		"alerts": []map[string]any{
+			{
+				"onset":          onset.Format(time.RFC3339),
+				"expires":        onset.Add(6 * time.Hour).Format(time.RFC3339),
+				"severity":       "moderate",
+				"headline_en":    "Official WARNING of WIND GUSTS",
+				"description_en": "There is a risk of wind gusts.",
+			},
+			{
+				"onset":    onset.Format(time.RFC3339),
+				"expires":  nil,
+				"severity": "minor",
+			},
+		},
+	}
+
+	var request *http.Request
+	server := newFakeServer(t, payload, &request)
+
+	service := NewBrightSkyAlertService().(*brightSkyAlertService)
+	service.alertsUrl = server.URL
+
+	alerts, err := service.GetAlerts(13.4, 52.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request.URL.Query().Get("lat") == "" {
+		t.Errorf("expected location to be sent")
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, but got %d", len(alerts))
+	}
+	if alerts[0].Type != "official" || alerts[0].Severity != "moderate" || !alerts[0].Start.Equal(onset) || !alerts[0].End.Equal(onset.Add(6*time.Hour)) {
+		t.Errorf("unexpected alert %+v", alerts[0])
+	}
+	if !alerts[1].End.IsZero() {
+		t.Errorf("expected open-ended alert, but got end %v", alerts[1].End)
+	}
+
+	if _, err := NewAlertService("unknown"); err == nil {
+		t.Errorf("expected error for unknown alert provider")
+	}
+}
+
+func TestNewWeatherService(t *testing.T) {
+	tests := []struct {
+		provider  string
+		config    WeatherProviderConfig
+		expectErr bool
+	}{
+		{"openweathermap", WeatherProviderConfig{OwmApiKey: "key"}, false},
+		{"openweathermap", WeatherProviderConfig{}, true},
+		{"open-meteo", WeatherProviderConfig{}, false},
+		{"brightsky", WeatherProviderConfig{}, false},
+		{"metno", WeatherProviderConfig{UserAgent: "test"}, false},
+		{"metno", WeatherProviderConfig{}, true},
+		{"unknown", WeatherProviderConfig{}, true},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", i), func(t *testing.T) {
+			_, err := NewWeatherService(test.provider, test.config)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("provider %s: expected error %v, but got %v", test.provider, test.expectErr, err)
+			}
+		})
+	}
+}
+
+// Weather service that fails as long as err is set and counts its calls.
+type fakeWeatherService struct {
+	err   error
+	calls int
+}
+
+func (s *fakeWeatherService) GetWeatherForecast(lon float64, lat float64) (models.WeatherSummary, error) {
+	s.calls++
+	if s.err != nil {
+		return models.WeatherSummary{}, s.err
+	}
+	return models.WeatherSummary{CurrentTemperature: 20}, nil
+}
+
+func TestFailoverWeatherService(t *testing.T) {
+	primary := &fakeWeatherService{err: errors.New("quota exhausted")}
+	secondary := &fakeWeatherService{}
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	service := newFailoverWeatherService([]*failoverProvider{
+		{name: "primary", service: primary},
+		{name: "secondary", service: secondary},
+	}, 2, time.Minute)
+	service.now = func() time.Time { return now }
+
+	for i := range 2 {
+		summary, err := service.GetWeatherForecast(13.4, 52.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Source != "secondary" {
+			t.Fatalf("request %d: expected source secondary, but got %q", i, summary.Source)
+		}
+	}
+
+	// The primary provider failed twice and is skipped during the cooldown
+	service.GetWeatherForecast(13.4, 52.5)
+	if primary.calls != 2 {
+		t.Fatalf("expected unhealthy provider to be skipped, but it was called %d times", primary.calls)
+	}
+
+	// After the cooldown, the primary provider is tried again
+	now = now.Add(time.Minute)
+	primary.err = nil
+
+	summary, err := service.GetWeatherForecast(13.4, 52.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Source != "primary" {
+		t.Fatalf("expected source primary after cooldown, but got %q", summary.Source)
+	}
+
+	// All providers failing results in an error
+	primary.err = errors.New("network error")
+	secondary.err = errors.New("bad gateway")
+
+	if _, err := service.GetWeatherForecast(13.4, 52.5); err == nil {
+		t.Fatal("expected error when all providers fail")
+	}
+}
+
+// Weather service that blocks until released, to test request coalescing.
+type blockingWeatherService struct {
+	release chan struct{}
+	calls   atomic.Int64
+	lon     float64
+	lat     float64
+}
+
+func (s *blockingWeatherService) GetWeatherForecast(lon float64, lat float64) (models.WeatherSummary, error) {
+	s.calls.Add(1)
+	s.lon, s.lat = lon, lat
+	<-s.release
+	return models.WeatherSummary{CurrentTemperature: 20}, nil
+}
+
+func TestWeatherCache(t *testing.T) {
+	upstream := &blockingWeatherService{release: make(chan struct{})}
+
+	now := time.Date(2025, 6, 1, 10, 30, 0, 0, time.UTC)
+
+	cache := NewWeatherCache(upstream, 0.1).(*weatherCache)
+	cache.now = func() time.Time { return now }
+
+	// Concurrent requests within the same grid cell
+	var wg sync.WaitGroup
+	for _, lon := range []float64{13.41, 13.42, 13.38} {
+		wg.Go(func() {
+			if _, err := cache.GetWeatherForecast(lon, 52.52); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Wait until the upstream request was issued, before releasing it
+	for upstream.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(upstream.release)
+	wg.Wait()
+
+	if calls := upstream.calls.Load(); calls != 1 {
+		t.Fatalf("expected 1 upstream request, but got %d", calls)
+	}
+	if math.Abs(upstream.lon-13.4) > 1e-9 || math.Abs(upstream.lat-52.5) > 1e-9 {
+		t.Fatalf("expected request for grid cell center, but got %f, %f", upstream.lon, upstream.lat)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+
+	// A different cell is a miss
+	cache.GetWeatherForecast(10, 50)
+	if calls := upstream.calls.Load(); calls != 2 {
+		t.Fatalf("expected 2 upstream requests, but got %d", calls)
+	}
+
+	// Entries expire with the 3-hour forecast block
+	now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache.GetWeatherForecast(13.4, 52.5)
+	if calls := upstream.calls.Load(); calls != 3 {
+		t.Fatalf("expected expired entry to be refreshed, but got %d upstream requests", calls)
+	}
+
+	if stats := cache.Stats(); stats.Entries != 1 {
+		t.Fatalf("expected expired entries to be removed, but got %d entries", stats.Entries)
+	}
+}
+
+type countingAlertService struct {
+	calls int
+}
+
+func (s *countingAlertService) GetAlerts(lon float64, lat float64) ([]models.Alert, error) {
+	s.calls++
+	return []models.Alert{{Type: "official"}}, nil
+}
+
+func TestAlertCache(t *testing.T) {
+	upstream := &countingAlertService{}
+
+	now := time.Date(2025, 6, 1, 10, 30, 0, 0, time.UTC)
+
+	cache := NewAlertCache(upstream, 0.1).(*alertCache)
+	cache.now = func() time.Time { return now }
+
+	for _, lon := range []float64{13.41, 13.42, 13.38} {
+		alerts, err := cache.GetAlerts(lon, 52.52)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 1 {
+			t.Fatalf("expected cached alert, but got %+v", alerts)
+		}
+	}
+
+	if upstream.calls != 1 {
+		t.Fatalf("expected 1 upstream request, but got %d", upstream.calls)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+
+	// Entries expire after a few minutes
+	now = now.Add(5 * time.Minute)
+	cache.GetAlerts(13.4, 52.5)
+	if upstream.calls != 2 {
+		t.Fatalf("expected expired entry to be refreshed, but got %d upstream requests", upstream.calls)
+	}
+}
+
+func TestPoiTileCache(t *testing.T) {
+	var queries []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		queries = append(queries, string(body))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"elements": [
+			{"type": "node", "lon": 13.41, "lat": 52.52, "tags": {"name": "Near", "amenity": "cafe"}},
+			{"type": "way", "bounds": {"minlat": 52.60, "minlon": 13.50, "maxlat": 52.62, "maxlon": 13.52}, "tags": {"name": "Way", "amenity": "cafe"}},
+			{"type": "node", "lon": 14.5, "lat": 52.5, "tags": {"name": "Too far", "amenity": "cafe"}}
+		]}`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "poi-cache.json")
+
+	cache, err := NewPoiTileCache(path, 0.25, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := LoadPoiCategories("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewOverpassPoiService(categories, 25, cache).(*overpassPoiService)
+	service.url = server.URL
+
+	for range 2 {
+		sites, err := service.GetPois("cafe", 13.4, 52.5, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sites) != 2 {
+			t.Fatalf("expected 2 sites within the radius, but got %d", len(sites))
+		}
+	}
+
+	if len(queries) != 1 {
+		t.Fatalf("expected 1 overpass query, but got %d", len(queries))
+	}
+	if strings.Contains(queries[0], "around") {
+		t.Fatalf("expected bounding box query, but got %s", queries[0])
+	}
+
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+
+	// Tiles survive a restart
+	if err := cache.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewPoiTileCache(path, 0.25, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service.cache = reloaded
+	if _, err := service.GetPois("cafe", 13.4, 52.5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("expected reloaded cache to answer, but got %d overpass queries", len(queries))
+	}
+
+	// Other categories and expired tiles are fetched again
+	service.GetPois("camping", 13.4, 52.5, 0)
+
+	reloaded.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	service.GetPois("cafe", 13.4, 52.5, 0)
+
+	if len(queries) != 3 {
+		t.Fatalf("expected 3 overpass queries, but got %d", len(queries))
+	}
+
+	// The oldest tiles are evicted beyond the maximum
+	cafe, _ := categories.Get("cafe")
+	reloaded.maxTiles = 2
+	for x := range int64(3) {
+		reloaded.now = func() time.Time { return time.Now().Add(3*time.Hour + time.Duration(x)*time.Minute) }
+		reloaded.store(cafe, []poiTileKey{{x: x, y: 0}}, nil)
+	}
+	if stats := reloaded.Stats(); stats.Entries != 2 {
+		t.Fatalf("expected 2 tiles, but got %d", stats.Entries)
+	}
+	if _, missing := reloaded.collect(cafe, []poiTileKey{{x: 0, y: 0}, {x: 2, y: 0}}); !slices.Equal(missing, []poiTileKey{{x: 0, y: 0}}) {
+		t.Fatalf("expected the oldest tile to be evicted, but %v are missing", missing)
+	}
+}
+
+func TestPoisByCategory(t *testing.T) {
+	var queries []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		queries = append(queries, string(body))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"elements": [
+			{"type": "node", "id": 1, "lon": 13.41, "lat": 52.51, "tags": {"amenity": "cafe"}},
+			{"type": "node", "id": 2, "lon": 13.42, "lat": 52.52, "tags": {"amenity": "drinking_water"}},
+			{"type": "node", "id": 3, "lon": 13.43, "lat": 52.53, "tags": {"amenity": "cafe", "drinking_water": "yes"}}
+		]}`)
+	}))
+	defer server.Close()
+
+	cache, err := NewPoiTileCache("", 0.25, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := LoadPoiCategories("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewOverpassPoiService(categories, 25, cache).(*overpassPoiService)
+	service.url = server.URL
+
+	sites, err := service.GetPoisByCategory([]string{"cafe", "water", "cafe"}, 13.4, 52.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queries) != 1 || !strings.Contains(queries[0], "cafe") || !strings.Contains(queries[0], "drinking_water") {
+		t.Fatalf("expected a single query for both categories, but got %v", queries)
+	}
+	if len(sites) != 2 || len(sites["cafe"]) != 2 || len(sites["water"]) != 2 {
+		t.Fatalf("expected 2 cafes and 2 water sites, but got %+v", sites)
+	}
+	if sites["water"][0].OsmId != 2 || sites["water"][1].OsmId != 3 {
+		t.Errorf("expected water sites 2 and 3, but got %+v", sites["water"])
+	}
+
+	// Both categories are cached now
+	if cafes, _ := service.GetPois("cafe", 13.4, 52.5, 0); len(cafes) != 2 || len(queries) != 1 {
+		t.Fatalf("expected 2 cached cafes, but got %d and %d queries", len(cafes), len(queries))
+	}
+
+	if _, err := service.GetPoisByCategory([]string{"cafe", "castle"}, 13.4, 52.5, 0); !errors.Is(err, ErrUnknownCategory) {
+		t.Fatalf("expected unknown category error, but got %v", err)
+	}
+}
+
+func TestOfflinePoiService(t *testing.T) {
+	categories, err := LoadPoiCategories("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := func(element overpassElement, tags map[string]string) offlineElement {
+		element.Tags = tags
+		return offlineElement{Element: element, Categories: categories.matching(tags)}
+	}
+
+	index := newPoiIndex([]offlineElement{
+		tagged(overpassElement{OverpassType: "node", ID: 1, Lon: 13.41, Lat: 52.51}, map[string]string{"amenity": "drinking_water"}),
+		tagged(overpassElement{OverpassType: "node", ID: 2, Lon: 13.42, Lat: 52.52}, map[string]string{"amenity": "drinking_water", "access": "private"}),
+		tagged(overpassElement{OverpassType: "node", ID: 3, Lon: 13.35, Lat: 52.45}, map[string]string{"amenity": "cafe", "drinking_water": "yes"}),
+		tagged(overpassElement{OverpassType: "node", ID: 4, Lon: 15.00, Lat: 52.50}, map[string]string{"amenity": "drinking_water"}),
+	})
+
+	// The private fountain matches no category, so no search returns it
+	if categories := index.elements[1].Categories; categories != nil {
+		t.Fatalf("expected private drinking water not to match, but got %v", categories)
+	}
+
+	service := NewOfflinePoiService(index, categories, 25)
+
+	water, err := service.GetPois("water", 13.4, 52.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(water) != 2 {
+		t.Fatalf("expected 2 drinking water sites, but got %d", len(water))
+	}
+
+	// The radius is limited to the maximum distance
+	if near, _ := service.GetPois("water", 13.4, 52.5, 2); len(near) != 1 || near[0].OsmId != 1 {
+		t.Fatalf("expected only node 1 within 2 km, but got %+v", near)
+	}
+	if far, _ := service.GetPois("water", 13.4, 52.5, 200); len(far) != 2 {
+		t.Fatalf("expected 2 drinking water sites within the maximum distance, but got %d", len(far))
+	}
+
+	cafes, _ := service.GetPois("cafe", 13.4, 52.5, 0)
+	if len(cafes) != 1 {
+		t.Fatalf("expected 1 cafe, but got %d", len(cafes))
+	}
+
+	if _, err := service.GetPois("castle", 13.4, 52.5, 0); !errors.Is(err, ErrUnknownCategory) {
+		t.Fatalf("expected unknown category error, but got %v", err)
+	}
+
+	if cafes[0].OsmType != "node" || cafes[0].OsmId != 3 {
+		t.Fatalf("expected node 3, but got %s %d", cafes[0].OsmType, cafes[0].OsmId)
+	}
+
+	details, err := service.GetPoiDetails("node", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.DrinkingWater == nil || !*details.DrinkingWater {
+		t.Fatalf("expected cafe with drinking water, but got %+v", details)
+	}
+
+	if _, err := service.GetPoiDetails("way", 3); !errors.Is(err, ErrPoiNotFound) {
+		t.Fatalf("expected POI not found error, but got %v", err)
+	}
+}
+
+func TestPoisAlongRoute(t *testing.T) {
+	categories, err := LoadPoiCategories("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	water := func(id int64, lon float64, lat float64) offlineElement {
+		return offlineElement{
+			Element:    overpassElement{OverpassType: "node", ID: id, Lon: lon, Lat: lat, Tags: map[string]string{"amenity": "drinking_water"}},
+			Categories: []string{"water"},
+		}
+	}
+
+	// Route to the east along 52°N, about 68.5 km per degree
+	index := newPoiIndex([]offlineElement{
+		water(1, 13.1, 52.01),
+		water(2, 13.5, 51.99),
+		water(3, 13.9, 52.005),
+		water(4, 13.5, 52.2),
+		water(5, 12.9, 52.0),
+	})
+	route := models.Route{{Lon: 13, Lat: 52}, {Lon: 14, Lat: 52}}
+
+	service := NewOfflinePoiService(index, categories, 25)
+
+	sites, err := service.GetPoisAlongRoute("water", route, 2, models.Location{Lon: 13.2, Lat: 52})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Behind the position, outside the corridor and before the start
+	if len(sites) != 2 || sites[0].OsmId != 2 || sites[1].OsmId != 3 {
+		t.Fatalf("expected sites 2 and 3, but got %+v", sites)
+	}
+
+	if routeDistance := *sites[0].RouteDistance; math.Abs(routeDistance-20.5) > 0.5 {
+		t.Errorf("expected route distance of about 20.5 km, but got %f", routeDistance)
+	}
+	if detour := *sites[0].DetourDistance; math.Abs(detour-2.2) > 0.1 {
+		t.Errorf("expected detour of about 2.2 km, but got %f", detour)
+	}
+}
+
+func TestOverpassPoisAlongRoute(t *testing.T) {
+	var queries []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		queries = append(queries, string(body))
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"elements": [
+			{"type": "node", "id": 1, "lon": 13.5, "lat": 51.99, "tags": {"amenity": "drinking_water"}},
+			{"type": "node", "id": 2, "lon": 15.5, "lat": 52.01, "tags": {"amenity": "drinking_water"}}
+		]}`)
+	}))
+	defer server.Close()
+
+	categories, err := LoadPoiCategories("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewPoiTileCache("", 0.25, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewOverpassPoiService(categories, 25, cache).(*overpassPoiService)
+	service.url = server.URL
+
+	// About 200 km to the east, the tiles of the corridor are requested in
+	// groups instead of the bounding box of the whole route
+	route := models.Route{{Lon: 13, Lat: 52}, {Lon: 16, Lat: 52}}
+
+	for range 2 {
+		sites, err := service.GetPoisAlongRoute("water", route, 2, route[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sites) != 2 || sites[0].OsmId != 1 || sites[1].OsmId != 2 {
+			t.Fatalf("expected sites 1 and 2, but got %+v", sites)
+		}
+	}
+
+	if len(queries) < 2 || strings.Contains(queries[0], "around") {
+		t.Fatalf("expected several bounding box queries, but got %v", queries)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("expected the second search to be cached, but got %+v", stats)
+	}
+
+	// Without a cache, the line of a long winding track is limited. The track
+	// has the maximum number of points, about 10 m apart.
+	service.cache = nil
+	queries = nil
+
+	var winding models.Route
+	for i := range 50000 {
+		lon := 13 + float64(i)*0.0001
+		winding = append(winding, models.Location{Lon: models.Coordinate(lon), Lat: models.Coordinate(52 + 0.01*math.Sin(lon*200))})
+	}
+
+	if _, err := service.GetPoisAlongRoute("water", winding, 2, winding[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("expected 1 overpass query, but got %d", len(queries))
+	}
+	// The around filter is repeated for every element type
+	area := strings.Split(strings.SplitN(queries[0], "around:", 2)[1], ")")[0]
+	if points := strings.Count(area, ",") / 2; points > maxRouteQueryPoints {
+		t.Fatalf("expected at most %d points, but got %d", maxRouteQueryPoints, points)
+	}
+}
+
+func TestPoiGeometry(t *testing.T) {
+	categories, err := LoadPoiCategories("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	camping, _ := categories.Get("camping")
+
+	// Triangular camp site with a gate, and a multipolygon made of two ways
+	var result overpassResult
+	err = json.Unmarshal([]byte(`{"elements": [
+		{"type": "way", "id": 1, "bounds": {"minlat": 52.0, "minlon": 13.0, "maxlat": 52.03, "maxlon": 13.03},
+			"nodes": [10, 11, 12, 10],
+			"geometry": [{"lat": 52.0, "lon": 13.0}, {"lat": 52.0, "lon": 13.03}, {"lat": 52.03, "lon": 13.0}, {"lat": 52.0, "lon": 13.0}],
+			"tags": {"tourism": "camp_site"}},
+		{"type": "node", "id": 11, "lat": 52.0, "lon": 13.03, "tags": {"entrance": "main"}},
+		{"type": "relation", "id": 2, "bounds": {"minlat": 52.1, "minlon": 13.0, "maxlat": 52.13, "maxlon": 13.03},
+			"members": [
+				{"type": "way", "ref": 20, "role": "outer", "geometry": [{"lat": 52.1, "lon": 13.0}, {"lat": 52.1, "lon": 13.03}]},
+				{"type": "way", "ref": 21, "role": "outer", "geometry": [{"lat": 52.1, "lon": 13.0}, {"lat": 52.13, "lon": 13.0}, {"lat": 52.1, "lon": 13.03}]}
+			],
+			"tags": {"tourism": "camp_site"}}
+	]}`), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elements := camping.attachEntrances(result.Elements)
+	if len(elements) != 2 {
+		t.Fatalf("expected the entrance node to be removed, but got %d elements", len(elements))
+	}
+
+	sites := newPoiSites(elements, camping, 13.01, 51.99, 25)
+	if len(sites) != 2 || sites[0].OsmId != 1 {
+		t.Fatalf("expected the way and the relation, but got %+v", sites)
+	}
+
+	near := func(value float64, expected float64) bool {
+		return math.Abs(value-expected) < 1e-9
+	}
+
+	way, relation := sites[0], sites[1]
+	if !near(way.Lon, 13.01) || !near(way.Lat, 52.01) {
+		t.Errorf("expected the way at its centroid 13.01, 52.01, but got %v, %v", way.Lon, way.Lat)
+	}
+	if way.AccessLon != 13.03 || way.AccessLat != 52.0 {
+		t.Errorf("expected access at the entrance, but got %v, %v", way.AccessLon, way.AccessLat)
+	}
+	if !near(relation.Lon, 13.01) || !near(relation.Lat, 52.11) {
+		t.Errorf("expected the relation at its centroid 13.01, 52.11, but got %v, %v", relation.Lon, relation.Lat)
+	}
+	if !near(relation.AccessLon, 13.01) || !near(relation.AccessLat, 52.1) {
+		t.Errorf("expected access at the nearest point of the outline, but got %v, %v", relation.AccessLon, relation.AccessLat)
+	}
+}
+
+func TestPoiDetails(t *testing.T) {
+	element := overpassElement{
+		OverpassType: "way",
+		ID:           42,
+		Tags: map[string]string{
+			"tourism":        "camp_site",
+			"contact:phone":  "+49 30 123456",
+			"charge":         "12 EUR",
+			"capacity":       "40",
+			"tents":          "yes",
+			"shower":         "hot",
+			"power_supply":   "no",
+			"wheelchair":     "designated",
+			"drinking_water": "permissive",
+		},
+	}
+	element.Bounds.MinLon, element.Bounds.MaxLon = 13.0, 13.2
+	element.Bounds.MinLat, element.Bounds.MaxLat = 52.0, 52.2
+
+	details := newPoiDetails(element)
+
+	if details.OsmType != "way" || details.OsmId != 42 || details.Lon != 13.1 || details.Lat != 52.1 {
+		t.Fatalf("unexpected element %+v", details)
+	}
+	if details.Phone != "+49 30 123456" {
+		t.Errorf("expected phone from contact:phone, but got %q", details.Phone)
+	}
+	if details.Fee == nil || !*details.Fee {
+		t.Errorf("expected fee to be implied by the charge")
+	}
+	if details.Capacity == nil || *details.Capacity != 40 {
+		t.Errorf("expected capacity 40, but got %v", details.Capacity)
+	}
+	if details.Tents == nil || !*details.Tents || details.Shower == nil || !*details.Shower {
+		t.Errorf("expected tents and shower")
+	}
+	if details.PowerSupply == nil || *details.PowerSupply {
+		t.Errorf("expected no power supply")
+	}
+	// An access value is no yes/no value
+	if details.DrinkingWater != nil {
+		t.Errorf("expected unknown drinking water, but got %v", *details.DrinkingWater)
+	}
+	if details.Wheelchair != "yes" {
+		t.Errorf("expected wheelchair yes, but got %q", details.Wheelchair)
+	}
+	if len(details.Tags) != 9 {
+		t.Errorf("expected all 9 tags, but got %d", len(details.Tags))
+	}
+}
+
+func TestPoiCategories(t *testing.T) {
+	categories, err := parsePoiCategories([]byte(`[{
+		"name": "camping",
+		"icon": "campsite",
+		"filters": [["tourism=camp_site"], ["tourism=caravan_site", "tents"]],
+		"exclude": ["tent=no", "disused"],
+		"tags": ["fee"]
+	}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	camping, ok := categories.Get("camping")
+	if !ok {
+		t.Fatal("expected category camping")
+	}
+
+	expectedQuery := `[out:json];(nwr["tourism"="camp_site"]["tent"!="no"][!"disused"](around:1000,52.5,13.4);` +
+		`nwr["tourism"="caravan_site"]["tents"]["tent"!="no"][!"disused"](around:1000,52.5,13.4););out geom;`
+	if query := camping.overpassQuery("around:1000,52.5,13.4"); query != expectedQuery {
+		t.Fatalf("expected query\n%s\nbut got\n%s", expectedQuery, query)
+	}
+
+	tests := []struct {
+		tags     map[string]string
+		expected bool
+	}{
+		{map[string]string{"tourism": "camp_site"}, true},
+		{map[string]string{"tourism": "camp_site", "tent": "yes"}, true},
+		{map[string]string{"tourism": "camp_site", "tent": "no"}, false},
+		{map[string]string{"tourism": "camp_site", "disused": "yes"}, false},
+		{map[string]string{"tourism": "caravan_site"}, false},
+		{map[string]string{"tourism": "caravan_site", "tents": "4"}, true},
+		{map[string]string{}, false},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Test %d", i), func(t *testing.T) {
+			if actual := camping.matches(test.tags); actual != test.expected {
+				t.Fatalf("tags %v: expected match %v, but got %v", test.tags, test.expected, actual)
+			}
+		})
+	}
+
+	invalid := []string{
+		`[{"name": "empty", "filters": []}]`,
+		`[{"name": "a", "filters": [["x=y"]]}, {"name": "a", "filters": [["x=y"]]}]`,
+		`[{"name": "a", "filters": [["=y"]]}]`,
+	}
+	for _, data := range invalid {
+		if _, err := parsePoiCategories([]byte(data)); err == nil {
+			t.Fatalf("expected error for categories %s", data)
+		}
+	}
+
+	// The built-in categories must always be valid
+	builtIn, err := LoadPoiCategories("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builtInTests := []struct {
+		tags     map[string]string
+		expected []string
+	}{
+		{map[string]string{"tourism": "camp_site", "tent": "no"}, nil},
+		{map[string]string{"amenity": "cafe", "drinking_water": "yes"}, []string{"water", "cafe"}},
+		{map[string]string{"amenity": "drinking_water", "access": "private"}, nil},
+		{map[string]string{"leisure": "bird_hide"}, []string{"observation"}},
+		{map[string]string{"shop": "bicycle"}, []string{"bicycle_shop"}},
+		{map[string]string{"amenity": "bicycle_repair_station"}, []string{"repair_station"}},
+		{map[string]string{"amenity": "toilets", "access": "customers"}, nil},
+		{map[string]string{"amenity": "shelter", "shelter_type": "weather_shelter"}, []string{"shelter"}},
+		{map[string]string{"amenity": "shelter", "access": "private"}, nil},
+		{map[string]string{"shop": "bakery", "amenity": "cafe"}, []string{"cafe", "bakery"}},
+		{map[string]string{"railway": "halt"}, []string{"railway_station"}},
+		{map[string]string{"railway": "station", "station": "subway"}, nil},
+	}
+
+	for i, test := range builtInTests {
+		t.Run(fmt.Sprintf("Built-in %d", i), func(t *testing.T) {
+			if actual := builtIn.matching(test.tags); !slices.Equal(actual, test.expected) {
+				t.Fatalf("tags %v: expected categories %v, but got %v", test.tags, test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRainViewerNowcast(t *testing.T) {
+	lon, lat := 13.4, 52.5
+	x, y := radarPixel(lon, lat)
+	locationX, locationY := int(x), int(y)
+
+	// A shower of 40 dBZ moves east by 10 pixels between the frames, the
+	// latest frame is 10 minutes old
+	latestTime := time.Now().Truncate(time.Second).Add(-10 * time.Minute)
+	showerStart := map[string]int{"/v2/radar/1": locationX - 50, "/v2/radar/2": locationX - 40}
+
+	var tileRequests atomic.Int64
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/maps" {
+			json.NewEncoder(w).Encode(map[string]any{
+				"host": server.URL,
+				"radar": map[string]any{"past": []map[string]any{
+					{"time": latestTime.Add(-20 * time.Minute).Unix(), "path": "/v2/radar/0"},
+					{"time": latestTime.Add(-10 * time.Minute).Unix(), "path": "/v2/radar/1"},
+					{"time": latestTime.Unix(), "path": "/v2/radar/2"},
+				}},
+			})
+			return
+		}
+
+		var frame, size, zoom, tileX, tileY int
+		if _, err := fmt.Sscanf(r.URL.Path, "/v2/radar/%d/%d/%d/%d/%d/0/0_0.png", &frame, &size, &zoom, &tileX, &tileY); err != nil {
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		tileRequests.Add(1)
+
+		start := showerStart[fmt.Sprintf("/v2/radar/%d", frame)]
+		tile := image.NewGray(image.Rect(0, 0, size, size))
+		for py := range size {
+			for px := range size {
+				globalX, globalY := tileX*size+px, tileY*size+py
+				if globalX >= start && globalX < start+20 && globalY >= locationY-10 && globalY < locationY+10 {
+					tile.Pix[py*size+px] = 32 + 40
+				}
+			}
+		}
+		png.Encode(w, tile)
+	}))
+	t.Cleanup(server.Close)
+
+	service := NewRainViewerService(60).(*rainViewerService)
+	service.mapsUrl = server.URL + "/maps"
+
+	steps, err := service.GetNowcast(lon, lat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(steps) != 13 {
+		t.Fatalf("expected 13 steps, but got %d", len(steps))
+	}
+
+	// The shower arrives after 10 minutes and has passed after 30 minutes,
+	// the steps at the edges are partly wet
+	for i, wet := range map[int]bool{0: false, 1: false, 3: true, 4: true, 5: true, 7: false, 12: false} {
+		if (steps[i].RainIntensity > 0) != wet {
+			t.Errorf("step %d: expected rain %v, but got %+v", i, wet, steps[i])
+		}
+	}
+	if steps[4].RainIntensity != 3 || math.Abs(steps[4].Rain-11.53) > 0.01 {
+		t.Errorf("expected heavy rain of 11.53 mm/h, but got %+v", steps[4])
+	}
+
+	// Tiles are cached
+	if _, err := service.GetNowcast(lon, lat); err != nil {
+		t.Fatal(err)
+	}
+	if requests := tileRequests.Load(); requests != 18 {
+		t.Errorf("expected 18 tile requests, but got %d", requests)
+	}
+
+	// So is the motion of the grid cell
+	if stats := service.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("unexpected cache stats %+v", stats)
+	}
+
+	// Concurrent requests for another cell estimate its motion once
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			if _, err := service.GetNowcast(lon+1, lat); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if stats := service.Stats(); stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("expected a single estimation, but got %+v", stats)
+	}
+
+	// The map ends before the poles
+	if _, err := service.GetNowcast(lon, 90); err == nil {
+		t.Error("expected an error at the pole")
+	}
+}
+
+func TestDemElevationService(t *testing.T) {
+	dir := t.TempDir()
+
+	// SRTM3 tile, rising by 1 m per sample to the east, with a void in the
+	// north-west corner
+	const size = 1201
+	data := make([]byte, size*size*2)
+	for row := range size {
+		for column := range size {
+			value := uint16(100 + column)
+			if row == 0 && column == 0 {
+				value = 0x8000
+			}
+			binary.BigEndian.PutUint16(data[2*(row*size+column):], value)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "N52E013.hgt"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewDemElevationService(dir)
+
+	elevation, err := service.Elevation(13.5, 52.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(elevation-700) > 1e-6 {
+		t.Errorf("expected 700 m, but got %f", elevation)
+	}
+
+	// Between two samples
+	elevation, _ = service.Elevation(13+0.5/(size-1), 52.5)
+	if math.Abs(elevation-100.5) > 1e-6 {
+		t.Errorf("expected 100.5 m, but got %f", elevation)
+	}
+
+	// Next to the void at the northern edge, only the valid samples count.
+	// The edge itself belongs to the next tile.
+	elevation, _ = service.Elevation(13+0.5/(size-1), 53-1e-9)
+	if math.Abs(elevation-101) > 1e-3 {
+		t.Errorf("expected 101 m, but got %f", elevation)
+	}
+
+	if _, err := service.Elevation(14.5, 52.5); !errors.Is(err, ErrNoElevation) {
+		t.Errorf("expected no elevation without tile, but got %v", err)
+	}
+
+	// Only the recently used tiles are kept
+	for lon := range maxHgtTiles {
+		service.Elevation(float64(lon)+0.5, 0.5)
+	}
+	tiles := service.(*demElevationService).tiles
+	if _, ok := tiles["N52E013.hgt"]; ok || len(tiles) != maxHgtTiles {
+		t.Errorf("expected the least recently used tile to be evicted, but got %d tiles", len(tiles))
+	}
+	if elevation, err := service.Elevation(13.5, 52.5); err != nil || math.Abs(elevation-700) > 1e-6 {
+		t.Errorf("expected evicted tile to be loaded again, but got %f, %v", elevation, err)
+	}
+
+	if name := hgtFileName(-0.5, -0.5); name != "S01W001.hgt" {
+		t.Errorf("expected S01W001.hgt, but got %s", name)
+	}
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/models"
+)
+
+type WeatherCache interface {
+	WeatherService
+	Cache
+}
+
+// In-memory weather cache
+//
+// Forecasts are cached by grid cell, see gridCache. Entries expire at the end
+// of the current forecast block, i.e. every 3 hours at 00:00, 03:00, ... UTC,
+// like the blocks of OpenWeatherMap.
+type weatherCache struct {
+	*gridCache[models.WeatherSummary]
+	next WeatherService
+}
+
+func NewWeatherCache(next WeatherService, resolution float64) WeatherCache {
+	const interval = 3 * time.Hour
+
+	return &weatherCache{
+		gridCache: newGridCache[models.WeatherSummary](resolution, func(now time.Time) time.Time {
+			return now.Truncate(interval).Add(interval)
+		}),
+		next: next,
+	}
+}
+
+func (c *weatherCache) GetWeatherForecast(lon float64, lat float64) (models.WeatherSummary, error) {
+	return c.get(lon, lat, c.next.GetWeatherForecast)
+}
@@ -0,0 +1,439 @@
+package timezone
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Precomputed grid of time zones
+//
+// The grid is the compact alternative to the boundary polygons. The earth is
+// divided into cells of equal size in degrees, each row of cells from west to
+// east is stored as runs of cells with the same zone. Cells, that a boundary
+// passes through, are looked up in the polygons of the zones, which are
+// stored after the grid. Zones of the open sea (Etc/*) are left out, the
+// nautical time zone covers them. File format, numbers of the header and the
+// grid are little endian uint16, numbers of the polygons are varints:
+//
+//	magic "tzgrid2\n"
+//	columns, rows, number of zones
+//	for each zone: length of the name, name
+//	for each row from north to south: number of runs, then zone and length of
+//	each run, where zone 0 is no zone, zone 0xffff is a boundary cell and
+//	zone i is the i-th name
+//	for each zone: number of polygons, for each polygon the number of rings,
+//	the outer ring first, for each ring the number of points, then the
+//	differences of lon and lat of each point to the previous one in 1/10000°
+type Grid struct {
+	columns, rows int
+	names         []string
+	// Boundaries of the names, the locations are only set for decoded grids
+	zones []zone
+	// Runs of each row, with the column after their end
+	runs [][]gridRun
+}
+
+type gridRun struct {
+	end  int
+	zone int
+}
+
+var gridMagic = []byte("tzgrid2\n")
+
+// Zone of the cells, that a boundary passes through
+const gridBoundary = math.MaxUint16
+
+// Points of the polygons per degree
+const gridPrecision = 1e4
+
+var ErrInvalidGrid = errors.New("invalid time zone grid")
+
+// Builds the grid with the given number of cells per degree from the
+// boundaries, in GeoJSON or in the protobuf format of tzf. Cells are assigned
+// to the zone whose boundaries contain the center of the cell, unless a
+// boundary passes through them.
+func BuildGrid(boundariesPath string, cellsPerDegree int) (*Grid, error) {
+	data, err := os.ReadFile(boundariesPath)
+	if err != nil {
+		log.Println("Could not read time zone boundaries:", err)
+		return nil, err
+	}
+
+	var zones []zone
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		resolver, err := newResolver(data)
+		if err != nil {
+			return nil, err
+		}
+		zones = resolver.zones
+	} else {
+		zones, err = decodeTzpb(data)
+		if err != nil {
+			log.Println("Could not decode time zone boundaries:", err)
+			return nil, err
+		}
+	}
+
+	return buildGrid(zones, cellsPerDegree), nil
+}
+
+// Crossing of a boundary of the zone with the center line of a row
+type gridCrossing struct {
+	lon  float64
+	zone int
+}
+
+func buildGrid(zones []zone, cellsPerDegree int) *Grid {
+	g := &Grid{
+		columns: 360 * cellsPerDegree,
+		rows:    180 * cellsPerDegree,
+		runs:    make([][]gridRun, 180*cellsPerDegree),
+	}
+	cellSize := 1 / float64(cellsPerDegree)
+	rowLat := func(r int) float64 {
+		return 90 - (float64(r)+0.5)*cellSize
+	}
+
+	// Zones with the same name share their index and are merged. The points
+	// are rounded like in the file, so that the boundary cells match the
+	// stored polygons.
+	indices := map[string]int{}
+	var merged [][]polygon
+	for _, z := range zones {
+		name := z.location.String()
+		if strings.HasPrefix(name, "Etc/") {
+			continue
+		}
+		if _, ok := indices[name]; !ok {
+			g.names = append(g.names, name)
+			g.zones = append(g.zones, zone{location: z.location})
+			merged = append(merged, nil)
+			indices[name] = len(g.names)
+		}
+		for _, p := range z.polygons {
+			rounded := make(polygon, len(p))
+			for i, ring := range p {
+				rounded[i] = make([][2]float64, len(ring))
+				for j, point := range ring {
+					rounded[i][j] = [2]float64{
+						math.Round(point[0]*gridPrecision) / gridPrecision,
+						math.Round(point[1]*gridPrecision) / gridPrecision,
+					}
+				}
+			}
+			merged[indices[name]-1] = append(merged[indices[name]-1], rounded)
+		}
+	}
+	for i, polygons := range merged {
+		g.zones[i] = newZone(g.zones[i].location, polygons)
+	}
+
+	// Each edge only crosses the rows between its ends, so all crossings are
+	// collected in one pass over the edges instead of one per row
+	crossings := make([][]gridCrossing, g.rows)
+	boundaries := make([]bool, g.rows*g.columns)
+	for i, z := range g.zones {
+		for _, p := range z.polygons {
+			for _, ring := range p {
+				for j, k := 0, len(ring)-1; j < len(ring); k, j = j, j+1 {
+					a, b := ring[j], ring[k]
+					g.markEdge(boundaries, cellSize, a, b)
+
+					first := max(0, int((90-max(a[1], b[1]))/cellSize-0.5))
+					last := min(g.rows-1, int((90-min(a[1], b[1]))/cellSize+0.5))
+					for r := first; r <= last; r++ {
+						// Same rule as in ringContains
+						if lat := rowLat(r); (a[1] > lat) != (b[1] > lat) {
+							lon := (b[0]-a[0])*(lat-a[1])/(b[1]-a[1]) + a[0]
+							crossings[r] = append(crossings[r], gridCrossing{lon: lon, zone: i + 1})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	row := make([]int, g.columns)
+
+	for r := range g.rows {
+		clear(row)
+
+		// The rings of all polygons of a zone are combined with the even-odd
+		// rule, which keeps holes empty. The first zone, that contains a cell,
+		// wins like in the resolver.
+		rowCrossings := crossings[r]
+		slices.SortFunc(rowCrossings, func(a gridCrossing, b gridCrossing) int {
+			return cmp.Or(cmp.Compare(a.zone, b.zone), cmp.Compare(a.lon, b.lon))
+		})
+
+		for i := 0; i+1 < len(rowCrossings); i += 2 {
+			west, east := rowCrossings[i], rowCrossings[i+1]
+			if west.zone != east.zone {
+				// Odd number of crossings, e.g. of an unclosed ring
+				i--
+				continue
+			}
+
+			first := max(0, int(math.Ceil((west.lon+180)/cellSize-0.5)))
+			last := min(g.columns-1, int(math.Floor((east.lon+180)/cellSize-0.5)))
+			for c := first; c <= last; c++ {
+				if row[c] == 0 {
+					row[c] = west.zone
+				}
+			}
+		}
+		crossings[r] = nil
+
+		for c := range row {
+			if boundaries[r*g.columns+c] {
+				row[c] = gridBoundary
+			}
+		}
+
+		for c, zoneIndex := range row {
+			runs := g.runs[r]
+			if len(runs) > 0 && runs[len(runs)-1].zone == zoneIndex {
+				runs[len(runs)-1].end = c + 1
+			} else {
+				g.runs[r] = append(runs, gridRun{end: c + 1, zone: zoneIndex})
+			}
+		}
+	}
+
+	return g
+}
+
+// Marks the cells, that the edge from a to b passes through.
+func (g *Grid) markEdge(boundaries []bool, cellSize float64, a [2]float64, b [2]float64) {
+	// In cells from the north-west corner
+	x0, y0 := (a[0]+180)/cellSize, (90-a[1])/cellSize
+	x1, y1 := (b[0]+180)/cellSize, (90-b[1])/cellSize
+	if x0 > x1 {
+		x0, y0, x1, y1 = x1, y1, x0, y0
+	}
+	cell := func(v float64, count int) int {
+		return min(count-1, max(0, int(math.Floor(v))))
+	}
+
+	for c := cell(x0, g.columns); c <= cell(x1, g.columns); c++ {
+		// Part of the edge within the column
+		yWest, yEast := y0, y1
+		if x1 > x0 {
+			yWest = y0 + (y1-y0)*(max(x0, float64(c))-x0)/(x1-x0)
+			yEast = y0 + (y1-y0)*(min(x1, float64(c+1))-x0)/(x1-x0)
+		}
+
+		for r := cell(min(yWest, yEast), g.rows); r <= cell(max(yWest, yEast), g.rows); r++ {
+			boundaries[r*g.columns+c] = true
+		}
+	}
+}
+
+// Returns the number of zones of the grid.
+func (g *Grid) Len() int {
+	return len(g.names)
+}
+
+func (g *Grid) Save(path string) error {
+	var buf bytes.Buffer
+	buf.Write(gridMagic)
+
+	write := func(values ...int) {
+		for _, value := range values {
+			binary.Write(&buf, binary.LittleEndian, uint16(value))
+		}
+	}
+
+	write(g.columns, g.rows, len(g.names))
+	for _, name := range g.names {
+		write(len(name))
+		buf.WriteString(name)
+	}
+
+	for _, runs := range g.runs {
+		write(len(runs))
+		start := 0
+		for _, run := range runs {
+			write(run.zone, run.end-start)
+			start = run.end
+		}
+	}
+
+	var polygons []byte
+	for _, z := range g.zones {
+		polygons = binary.AppendUvarint(polygons, uint64(len(z.polygons)))
+		for _, p := range z.polygons {
+			polygons = binary.AppendUvarint(polygons, uint64(len(p)))
+			for _, ring := range p {
+				polygons = binary.AppendUvarint(polygons, uint64(len(ring)))
+				var lon, lat int64
+				for _, point := range ring {
+					nextLon := int64(math.Round(point[0] * gridPrecision))
+					nextLat := int64(math.Round(point[1] * gridPrecision))
+					polygons = binary.AppendVarint(polygons, nextLon-lon)
+					polygons = binary.AppendVarint(polygons, nextLat-lat)
+					lon, lat = nextLon, nextLat
+				}
+			}
+		}
+	}
+	buf.Write(polygons)
+
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+func decodeGrid(data []byte) (*Grid, error) {
+	if !bytes.HasPrefix(data, gridMagic) {
+		return nil, ErrInvalidGrid
+	}
+	reader := bytes.NewReader(data[len(gridMagic):])
+
+	var err error
+	read := func() int {
+		var value uint16
+		if readErr := binary.Read(reader, binary.LittleEndian, &value); readErr != nil {
+			err = ErrInvalidGrid
+		}
+		return int(value)
+	}
+
+	g := &Grid{columns: read(), rows: read()}
+
+	zoneCount := read()
+	if err != nil {
+		return nil, err
+	}
+
+	for range zoneCount {
+		name := make([]byte, read())
+		if _, readErr := io.ReadFull(reader, name); readErr != nil {
+			return nil, ErrInvalidGrid
+		}
+		g.names = append(g.names, string(name))
+	}
+
+	g.runs = make([][]gridRun, g.rows)
+	for r := range g.rows {
+		runCount := read()
+		end := 0
+		for range runCount {
+			zoneIndex, length := read(), read()
+			if zoneIndex > zoneCount && zoneIndex != gridBoundary {
+				return nil, ErrInvalidGrid
+			}
+			end += length
+			g.runs[r] = append(g.runs[r], gridRun{end: end, zone: zoneIndex})
+		}
+		if err != nil || end != g.columns {
+			return nil, ErrInvalidGrid
+		}
+	}
+
+	for _, name := range g.names {
+		polygons, err := decodeGridPolygons(reader)
+		if err != nil {
+			return nil, ErrInvalidGrid
+		}
+
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			// Cells of zones, that the tz database of Go does not know yet,
+			// fall back to the nautical zone
+			log.Printf("Skipping unknown time zone %s: %v", name, err)
+		}
+		g.zones = append(g.zones, newZone(location, polygons))
+	}
+
+	return g, nil
+}
+
+func decodeGridPolygons(reader *bytes.Reader) ([]polygon, error) {
+	// Counts are bounded by the remaining bytes, so that corrupt files do
+	// not allocate huge slices
+	readCount := func() (int, error) {
+		count, err := binary.ReadUvarint(reader)
+		if err != nil || count > uint64(reader.Len()) {
+			return 0, ErrInvalidGrid
+		}
+		return int(count), nil
+	}
+
+	polygonCount, err := readCount()
+	if err != nil {
+		return nil, err
+	}
+
+	polygons := make([]polygon, polygonCount)
+	for i := range polygons {
+		ringCount, err := readCount()
+		if err != nil {
+			return nil, err
+		}
+
+		polygons[i] = make(polygon, ringCount)
+		for j := range polygons[i] {
+			pointCount, err := readCount()
+			if err != nil {
+				return nil, err
+			}
+
+			ring := make([][2]float64, pointCount)
+			var lon, lat int64
+			for k := range ring {
+				dLon, lonErr := binary.ReadVarint(reader)
+				dLat, latErr := binary.ReadVarint(reader)
+				if lonErr != nil || latErr != nil {
+					return nil, ErrInvalidGrid
+				}
+				lon, lat = lon+dLon, lat+dLat
+				ring[k] = [2]float64{float64(lon) / gridPrecision, float64(lat) / gridPrecision}
+			}
+			polygons[i][j] = ring
+		}
+	}
+
+	return polygons, nil
+}
+
+// Returns the zone of the cell, that contains the coordinate, or false if the
+// coordinate has no zone.
+func (g *Grid) lookup(lon float64, lat float64) (*time.Location, bool) {
+	if g.rows == 0 || g.columns == 0 {
+		return nil, false
+	}
+
+	r := min(g.rows-1, max(0, int((90-lat)/180*float64(g.rows))))
+	c := min(g.columns-1, max(0, int((lon+180)/360*float64(g.columns))))
+
+	// First run, that ends after the column
+	runs := g.runs[r]
+	i, _ := slices.BinarySearchFunc(runs, c, func(run gridRun, column int) int {
+		return run.end - 1 - column
+	})
+	if i == len(runs) || runs[i].zone == 0 {
+		return nil, false
+	}
+
+	if runs[i].zone == gridBoundary {
+		for _, z := range g.zones {
+			if z.location != nil && z.contains(lon, lat) {
+				return z.location, true
+			}
+		}
+		return nil, false
+	}
+
+	if location := g.zones[runs[i].zone-1].location; location != nil {
+		return location, true
+	}
+	return nil, false
+}
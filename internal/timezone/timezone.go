@@ -0,0 +1,241 @@
+// Package timezone resolves the IANA time zone of a coordinate.
+//
+// The zones are looked up in boundary polygons, given as GeoJSON feature
+// collection with a "tzid" property, the format of
+// https://github.com/evansiroky/timezone-boundary-builder, or in a grid that
+// was precomputed from such boundaries. The embedded grid has a resolution of
+// 0.1° and contains the simplified polygons of the cells along the borders. It
+// is built from release 2025b of timezone-boundary-builder, as distributed by
+// the Go module github.com/ringsaturn/tzf-rel-lite:
+//
+//	go mod download -json github.com/ringsaturn/tzf-rel-lite@v0.0.2025-b2
+//	rueckenwind timezones -output internal/timezone/zones.grid \
+//		$DIR/combined-with-oceans.reduce.bin
+//
+// where $DIR is the directory of the downloaded module. The boundaries are
+// licensed under the ODbL, see THIRD-PARTY-LICENSES. The exact boundaries can
+// be loaded from a file instead. Outside of the zones, e.g. on the open sea,
+// the nautical time zone of the longitude (Etc/GMT±N) is used.
+package timezone
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+	// Time zones must not depend on the system database
+	_ "time/tzdata"
+)
+
+//go:embed zones.grid
+var embeddedGrid []byte
+
+// Polygon with the outer ring first, followed by the holes. Points are
+// [lon, lat].
+type polygon [][][2]float64
+
+type zone struct {
+	location *time.Location
+	polygons []polygon
+	// Bounding box of all polygons
+	minLon, minLat, maxLon, maxLat float64
+}
+
+type Resolver struct {
+	// The first zone, that contains a coordinate, wins
+	zones []zone
+	// Only set, if the zones are looked up in a grid instead
+	grid *Grid
+}
+
+type featureCollection struct {
+	Features []struct {
+		Properties struct {
+			Tzid string `json:"tzid"`
+		} `json:"properties"`
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+	} `json:"features"`
+}
+
+// Creates a resolver from the boundaries in the GeoJSON or grid file. If the
+// path is empty, the embedded grid is used.
+func NewResolver(path string) (*Resolver, error) {
+	data := embeddedGrid
+
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			log.Println("Could not read time zone boundaries:", err)
+			return nil, err
+		}
+	}
+
+	if bytes.HasPrefix(data, gridMagic) {
+		grid, err := decodeGrid(data)
+		if err != nil {
+			log.Println("Could not decode time zone grid:", err)
+			return nil, err
+		}
+		return &Resolver{grid: grid}, nil
+	}
+
+	return newResolver(data)
+}
+
+func newResolver(data []byte) (*Resolver, error) {
+	var collection featureCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		log.Println("Could not decode time zone boundaries:", err)
+		return nil, err
+	}
+
+	resolver := &Resolver{}
+	locations := map[string]*time.Location{}
+
+	for _, feature := range collection.Features {
+		tzid := feature.Properties.Tzid
+
+		location, ok := locations[tzid]
+		if !ok {
+			var err error
+			location, err = time.LoadLocation(tzid)
+			if err != nil {
+				// Newer boundaries may contain zones the tz database of Go
+				// does not know yet
+				log.Printf("Skipping unknown time zone %s: %v", tzid, err)
+				continue
+			}
+			locations[tzid] = location
+		}
+
+		var polygons []polygon
+		var err error
+		switch feature.Geometry.Type {
+		case "Polygon":
+			var p polygon
+			err = json.Unmarshal(feature.Geometry.Coordinates, &p)
+			polygons = []polygon{p}
+		case "MultiPolygon":
+			err = json.Unmarshal(feature.Geometry.Coordinates, &polygons)
+		default:
+			err = fmt.Errorf("unsupported geometry type %q", feature.Geometry.Type)
+		}
+		if err != nil {
+			log.Printf("Could not decode boundary of time zone %s: %v", tzid, err)
+			return nil, err
+		}
+
+		resolver.zones = append(resolver.zones, newZone(location, polygons))
+	}
+
+	return resolver, nil
+}
+
+func newZone(location *time.Location, polygons []polygon) zone {
+	z := zone{
+		location: location,
+		polygons: polygons,
+		minLon:   math.Inf(1),
+		minLat:   math.Inf(1),
+		maxLon:   math.Inf(-1),
+		maxLat:   math.Inf(-1),
+	}
+
+	for _, p := range polygons {
+		if len(p) == 0 {
+			continue
+		}
+		for _, point := range p[0] {
+			z.minLon = min(z.minLon, point[0])
+			z.maxLon = max(z.maxLon, point[0])
+			z.minLat = min(z.minLat, point[1])
+			z.maxLat = max(z.maxLat, point[1])
+		}
+	}
+
+	return z
+}
+
+func (z zone) contains(lon float64, lat float64) bool {
+	if lon < z.minLon || lon > z.maxLon || lat < z.minLat || lat > z.maxLat {
+		return false
+	}
+
+	for _, p := range z.polygons {
+		if len(p) == 0 || !ringContains(p[0], lon, lat) {
+			continue
+		}
+
+		inHole := false
+		for _, hole := range p[1:] {
+			if ringContains(hole, lon, lat) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Even-odd rule: a ray from the point crosses the ring an odd number of times,
+// if the point is inside.
+func ringContains(ring [][2]float64, lon float64, lat float64) bool {
+	inside := false
+
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > lat) != (b[1] > lat) && lon < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// Returns the time zone at the coordinate.
+func (r *Resolver) Lookup(lon float64, lat float64) *time.Location {
+	for _, z := range r.zones {
+		if z.contains(lon, lat) {
+			return z.location
+		}
+	}
+
+	if r.grid != nil {
+		if location, ok := r.grid.lookup(lon, lat); ok {
+			return location
+		}
+	}
+
+	return nauticalZone(lon)
+}
+
+// Returns the time zone of the 15° wide band around the longitude. The sign
+// of the Etc zones is inverted, Etc/GMT-1 is UTC+1.
+func nauticalZone(lon float64) *time.Location {
+	offset := int(math.Round(lon / 15))
+	offset = max(-12, min(12, offset))
+
+	name := "Etc/GMT"
+	if offset != 0 {
+		name = fmt.Sprintf("Etc/GMT%+d", -offset)
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		// Cannot happen with the embedded tz database
+		return time.FixedZone(name, offset*3600)
+	}
+	return location
+}
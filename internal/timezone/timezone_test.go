@@ -0,0 +1,194 @@
+package timezone
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	resolver, err := NewResolver("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lon, lat float64
+		zone     string
+	}{
+		{"Berlin", 13.40, 52.52, "Europe/Berlin"},
+		{"Munich", 11.58, 48.14, "Europe/Berlin"},
+		{"Paris", 2.35, 48.86, "Europe/Paris"},
+		{"Calais", 1.85, 50.95, "Europe/Paris"},
+		{"Dover", 1.31, 51.13, "Europe/London"},
+		{"Belfast", -5.93, 54.60, "Europe/London"},
+		{"Donegal", -8.10, 54.65, "Europe/Dublin"},
+		{"Lisbon", -9.14, 38.72, "Europe/Lisbon"},
+		{"Madrid", -3.70, 40.42, "Europe/Madrid"},
+		{"Basel", 7.59, 47.56, "Europe/Zurich"},
+		{"Copenhagen", 12.57, 55.68, "Europe/Copenhagen"},
+		{"Malmo", 13.00, 55.60, "Europe/Stockholm"},
+		{"Vaasa", 21.62, 63.10, "Europe/Helsinki"},
+		{"Mariehamn", 19.94, 60.10, "Europe/Mariehamn"},
+		{"Lesbos", 26.30, 39.10, "Europe/Athens"},
+		{"Izmir", 27.14, 38.42, "Europe/Istanbul"},
+		{"Moscow", 37.62, 55.76, "Europe/Moscow"},
+		{"New York", -74.01, 40.71, "America/New_York"},
+		{"Nashville", -86.78, 36.16, "America/Chicago"},
+		{"Denver", -104.99, 39.74, "America/Denver"},
+		{"Delhi", 77.21, 28.61, "Asia/Kolkata"},
+		{"Tokyo", 139.69, 35.69, "Asia/Tokyo"},
+		{"Perth", 115.86, -31.95, "Australia/Perth"},
+		{"Mid-Atlantic", -40.00, 40.00, "Etc/GMT+3"},
+		{"South Pacific", -130.00, -40.00, "Etc/GMT+9"},
+	}
+
+	for _, test := range tests {
+		if zone := resolver.Lookup(test.lon, test.lat).String(); zone != test.zone {
+			t.Errorf("%s: got %s, want %s", test.name, zone, test.zone)
+		}
+	}
+}
+
+func TestLookupBorderTowns(t *testing.T) {
+	resolver, err := NewResolver("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Towns on both sides of a border, a few hundred meters apart
+	tests := []struct {
+		name     string
+		lon, lat float64
+		zone     string
+	}{
+		{"Narva", 28.19, 59.38, "Europe/Tallinn"},
+		{"Ivangorod", 28.22, 59.37, "Europe/Moscow"},
+		{"Haparanda", 24.14, 65.84, "Europe/Stockholm"},
+		{"Tornio", 24.15, 65.85, "Europe/Helsinki"},
+		{"Frankfurt (Oder)", 14.55, 52.34, "Europe/Berlin"},
+		{"Slubice", 14.56, 52.35, "Europe/Warsaw"},
+		{"Goerlitz", 14.98, 51.15, "Europe/Berlin"},
+		{"Zgorzelec", 15.01, 51.15, "Europe/Warsaw"},
+		{"Strasbourg", 7.75, 48.58, "Europe/Paris"},
+		{"Kehl", 7.81, 48.57, "Europe/Berlin"},
+		{"Valga", 26.05, 57.78, "Europe/Tallinn"},
+		{"Valka", 26.02, 57.77, "Europe/Riga"},
+		{"Irun", -1.79, 43.34, "Europe/Madrid"},
+		{"Hendaye", -1.77, 43.36, "Europe/Paris"},
+		{"Tui", -8.64, 42.05, "Europe/Madrid"},
+		{"Valenca", -8.64, 42.03, "Europe/Lisbon"},
+		{"Kreuzlingen", 9.17, 47.65, "Europe/Zurich"},
+		{"Konstanz", 9.17, 47.66, "Europe/Berlin"},
+		{"El Paso", -106.49, 31.76, "America/Denver"},
+		{"Ciudad Juarez", -106.45, 31.72, "America/Ciudad_Juarez"},
+	}
+
+	for _, test := range tests {
+		if zone := resolver.Lookup(test.lon, test.lat).String(); zone != test.zone {
+			t.Errorf("%s: got %s, want %s", test.name, zone, test.zone)
+		}
+	}
+}
+
+func TestLookupDaylightSaving(t *testing.T) {
+	resolver, err := NewResolver("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	berlin := resolver.Lookup(13.40, 52.52)
+
+	winter, _ := time.Date(2024, time.January, 15, 12, 0, 0, 0, time.UTC).In(berlin).Zone()
+	summer, _ := time.Date(2024, time.July, 15, 12, 0, 0, 0, time.UTC).In(berlin).Zone()
+	if winter != "CET" || summer != "CEST" {
+		t.Errorf("got %s and %s, want CET and CEST", winter, summer)
+	}
+
+	newYork := resolver.Lookup(-74.01, 40.71)
+
+	winter, _ = time.Date(2024, time.January, 15, 12, 0, 0, 0, time.UTC).In(newYork).Zone()
+	summer, _ = time.Date(2024, time.July, 15, 12, 0, 0, 0, time.UTC).In(newYork).Zone()
+	if winter != "EST" || summer != "EDT" {
+		t.Errorf("got %s and %s, want EST and EDT", winter, summer)
+	}
+}
+
+func TestResolverBoundaries(t *testing.T) {
+	boundaries := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","properties":{"tzid":"America/New_York"},"geometry":{"type":"Polygon","coordinates":[
+			[[-80,35],[-70,35],[-70,45],[-80,45],[-80,35]],
+			[[-76,39],[-74,39],[-74,41],[-76,41],[-76,39]]
+		]}},
+		{"type":"Feature","properties":{"tzid":"Unknown/Zone"},"geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}}
+	]}`
+
+	resolver, err := newResolver([]byte(boundaries))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if zone := resolver.Lookup(-78, 37).String(); zone != "America/New_York" {
+		t.Errorf("got %s, want America/New_York", zone)
+	}
+
+	// Inside the hole
+	if zone := resolver.Lookup(-75, 40).String(); zone != "Etc/GMT+5" {
+		t.Errorf("got %s, want Etc/GMT+5", zone)
+	}
+
+	if _, err := newResolver([]byte(`{"features":[{"properties":{"tzid":"UTC"},"geometry":{"type":"Point","coordinates":[0,0]}}]}`)); err == nil {
+		t.Error("expected an error for a point geometry")
+	}
+}
+
+func TestGrid(t *testing.T) {
+	boundaries := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","properties":{"tzid":"Europe/Berlin"},"geometry":{"type":"Polygon","coordinates":[
+			[[6,47],[15,47],[15,55],[6,55],[6,47]],
+			[[12,50],[13,50],[13,51],[12,51],[12,50]]
+		]}},
+		{"type":"Feature","properties":{"tzid":"Europe/Paris"},"geometry":{"type":"Polygon","coordinates":[
+			[[-5,42],[8,42],[8,51],[-5,51],[-5,42]]
+		]}}
+	]}`
+
+	resolver, err := newResolver([]byte(boundaries))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "zones.grid")
+	if err := buildGrid(resolver.zones, 2).Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err = NewResolver(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		lon, lat float64
+		zone     string
+	}{
+		{"Inside the boundaries", 13.40, 52.52, "Europe/Berlin"},
+		// Inside both, the first zone wins
+		{"Saarbruecken", 7.00, 49.23, "Europe/Berlin"},
+		{"Paris", 2.35, 48.86, "Europe/Paris"},
+		{"Inside the hole", 12.50, 50.50, "Etc/GMT-1"},
+		{"Outside of the boundaries", -40.00, 40.00, "Etc/GMT+3"},
+	}
+
+	for _, test := range tests {
+		if zone := resolver.Lookup(test.lon, test.lat).String(); zone != test.zone {
+			t.Errorf("%s: got %s, want %s", test.name, zone, test.zone)
+		}
+	}
+
+	if _, err := decodeGrid([]byte("tzgrid2\n\x01\x00")); err == nil {
+		t.Error("expected an error for a truncated grid")
+	}
+}
@@ -0,0 +1,122 @@
+package timezone
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/leomfn/rueckenwind/internal/protobuf"
+)
+
+// Boundaries in the protobuf format of tzf, see
+// https://github.com/ringsaturn/tzf/blob/main/pb/tzinfo.proto, e.g.
+// combined-with-oceans.reduce.bin of github.com/ringsaturn/tzf-rel-lite, which
+// are simplified boundaries of timezone-boundary-builder:
+//
+//	message Point { float lng = 1; float lat = 2; }
+//	message Polygon { repeated Point points = 1; repeated Polygon holes = 2; }
+//	message Timezone { repeated Polygon polygons = 1; string name = 2; }
+//	message Timezones { repeated Timezone timezones = 1; bool reduced = 2; string version = 3; }
+//
+// Compressed boundaries (reduce.compress.bin) are not supported.
+func decodeTzpb(data []byte) ([]zone, error) {
+	var zones []zone
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			z, err := decodeTzpbTimezone(m.Bytes())
+			if err != nil {
+				return nil, err
+			}
+			if z.location != nil {
+				zones = append(zones, z)
+			}
+		case 3:
+			log.Printf("Decoding time zone boundaries of version %s", m.Bytes())
+		}
+	}
+	if m.Err() != nil {
+		return nil, m.Err()
+	}
+
+	if len(zones) == 0 {
+		return nil, errors.New("no time zones in boundaries")
+	}
+
+	return zones, nil
+}
+
+// Returns the zone, without location if the tz database of Go does not know
+// it.
+func decodeTzpbTimezone(data []byte) (zone, error) {
+	var name string
+	var polygons []polygon
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			p, err := decodeTzpbPolygon(m.Bytes())
+			if err != nil {
+				return zone{}, err
+			}
+			polygons = append(polygons, p)
+		case 2:
+			name = string(m.Bytes())
+		}
+	}
+	if m.Err() != nil {
+		return zone{}, m.Err()
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Skipping unknown time zone %s: %v", name, err)
+		return zone{}, nil
+	}
+
+	return newZone(location, polygons), nil
+}
+
+// Returns the outer ring followed by the holes.
+func decodeTzpbPolygon(data []byte) (polygon, error) {
+	p := polygon{nil}
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			point, err := decodeTzpbPoint(m.Bytes())
+			if err != nil {
+				return nil, err
+			}
+			p[0] = append(p[0], point)
+		case 2:
+			hole, err := decodeTzpbPolygon(m.Bytes())
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, hole[0])
+		}
+	}
+
+	return p, m.Err()
+}
+
+func decodeTzpbPoint(data []byte) ([2]float64, error) {
+	var point [2]float64
+
+	m := protobuf.NewMessage(data)
+	for m.Next() {
+		switch m.Field() {
+		case 1:
+			point[0] = float64(m.Float())
+		case 2:
+			point[1] = float64(m.Float())
+		}
+	}
+
+	return point, m.Err()
+}